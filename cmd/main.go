@@ -13,6 +13,8 @@ import (
 
 	"stockmind/internal/agent"
 	"stockmind/internal/database"
+	"stockmind/internal/evaluation"
+	"stockmind/internal/knowledge"
 	"stockmind/internal/mcp"
 	"stockmind/internal/server"
 
@@ -87,6 +89,97 @@ func main() {
 					return runMCP(ctx, protocol)
 				},
 			},
+			{
+				Name:  "ingest",
+				Usage: "Ingest the knowledge base documents into the database",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "dir",
+						Value: knowledge.DefaultDir,
+						Usage: "Directory containing the documents to ingest",
+					},
+					&cli.StringFlag{
+						Name:    "knowledge-base",
+						Aliases: []string{"kb"},
+						Value:   database.DefaultKnowledgeBaseName,
+						Usage:   "Name of the knowledge base to ingest into",
+					},
+					&cli.StringFlag{
+						Name:  "strategy",
+						Usage: "Chunking strategy (fixed_size, fixed_size_by_word, fixed_size_tokenized, recursive, recursive_tokenized, semantic, agentic, structural). Default is structural for HTML, DOCX, CSV and Markdown documents and recursive otherwise",
+					},
+					&cli.IntFlag{
+						Name:  "chunk-size",
+						Value: 1000,
+						Usage: "Maximum size of a chunk",
+					},
+					&cli.IntFlag{
+						Name:  "overlap",
+						Value: 0,
+						Usage: "Overlap between chunks",
+					},
+					&cli.StringFlag{
+						Name:  "embedder",
+						Value: agent.EmbeddingProvider.Provider,
+						Usage: "Embedding provider (openai, hash, none)",
+					},
+					&cli.StringFlag{
+						Name:  "llm-model",
+						Value: agent.GLM_4_5_AIR,
+						Usage: "OpenRouter model proposing sections for the agentic strategy",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Chunk documents again even when their content and chunking options are unchanged",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return runIngest(ctx, cmd.String("dir"), cmd.String("embedder"), cmd.String("llm-model"), knowledge.IngestOptions{
+						KnowledgeBase: cmd.String("knowledge-base"),
+						Strategy:      agent.ChunkingStrategy(cmd.String("strategy")),
+						ChunkSize:     int(cmd.Int("chunk-size")),
+						Overlap:       int(cmd.Int("overlap")),
+						Force:         cmd.Bool("force"),
+					})
+				},
+			},
+			{
+				Name:  "eval",
+				Usage: "Evaluate retrieval of a golden question set under several chunking and embedding configurations",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "golden",
+						Value: "schema/evaluation/golden.yaml",
+						Usage: "Golden question set (.yaml or .jsonl)",
+					},
+					&cli.StringFlag{
+						Name:  "configs",
+						Usage: "YAML or JSON file listing the configurations to compare. Default compares fixed_size_by_word with recursive chunking",
+					},
+					&cli.StringFlag{
+						Name:  "dir",
+						Value: knowledge.DefaultDir,
+						Usage: "Directory containing the documents to ingest for every configuration",
+					},
+					&cli.IntFlag{
+						Name:  "k",
+						Value: 5,
+						Usage: "Number of retrieved chunks scored per question",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "table",
+						Usage: "Output format (table, json)",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "File to write the JSON report to, with the metrics of every question",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return runEval(ctx, cmd.String("golden"), cmd.String("configs"), cmd.String("dir"), int(cmd.Int("k")), cmd.String("format"), cmd.String("output"))
+				},
+			},
 		},
 	}
 	if err := app.Run(context.Background(), os.Args); err != nil {
@@ -96,61 +189,176 @@ func main() {
 
 func runMCP(ctx context.Context, protocol string) error {
 	log.Printf("Running MCP server with protocol: %s", protocol)
-	return mcp.Start(ctx, protocol)
+	// The knowledge base tool needs the database, the other tools still work without it
+	var searcher *agent.KnowledgeSearcher
+	dbPool, err := connectDB(ctx)
+	if err != nil {
+		log.Printf("Knowledge base search tool is disabled: %v", err)
+	} else {
+		defer dbPool.Close()
+		searcher = agent.NewDefaultKnowledgeSearcher(database.New(dbPool))
+	}
+	return mcp.Start(ctx, protocol, searcher)
 }
 
-func runServer(ctx context.Context, port string, mcpProtocol string) (context.Context, func(), error) {
-	log.Printf("Running server on port: %s", port)
+func runIngest(ctx context.Context, dir string, embedderProvider string, llmModel string, opts knowledge.IngestOptions) error {
+	log.Printf("Ingesting documents from %s into knowledge base %s", dir, opts.KnowledgeBase)
+	var embedder agent.Embedder
+	if embedderProvider != "none" {
+		config := agent.EmbeddingProvider
+		config.Provider = embedderProvider
+		var err error
+		embedder, err = agent.NewEmbedder(config)
+		if err != nil {
+			return fmt.Errorf("failed to create embedder: %w", err)
+		}
+	}
 
-	var mcpShutdown func()
-	if mcpProtocol == "http" {
-		// Create MCP service and HTTP server
-		log.Printf("Initializing MCP server with HTTP protocol on 0.0.0.0:8081")
-		err := mcp.Start(ctx, mcpProtocol)
+	dbPool, err := connectDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer dbPool.Close()
+
+	service := knowledge.NewService(dbPool, embedder)
+	if opts.Strategy == agent.ChunkingStrategyAgentic {
+		llm, err := agent.NewLLMClient(database.ModelProviderOpenAI)
 		if err != nil {
-			log.Printf("Failed to start MCP: %v", err)
-			return nil, nil, err
+			return err
 		}
+		service.SetChunkingLLM(llm, llmModel)
+	}
+	return service.IngestDir(ctx, dir, opts)
+}
+
+func runEval(ctx context.Context, goldenPath, configsPath, dir string, k int, format, output string) error {
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+	questions, err := evaluation.LoadGoldenSet(goldenPath)
+	if err != nil {
+		return err
+	}
+	configs := evaluation.DefaultConfigs()
+	if configsPath != "" {
+		if configs, err = evaluation.LoadConfigs(configsPath); err != nil {
+			return err
+		}
+	}
+
+	dbPool, err := connectDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer dbPool.Close()
+
+	evaluator, err := evaluation.NewEvaluator(dbPool, dir, k)
+	if err != nil {
+		return err
+	}
+	log.Printf("Evaluating %d configurations on %d questions from %s", len(configs), len(questions), goldenPath)
+	report, err := evaluator.Run(ctx, questions, configs)
+	if err != nil {
+		return err
+	}
+
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create report %s: %w", output, err)
+		}
+		defer f.Close()
+		if err := report.WriteJSON(f); err != nil {
+			return fmt.Errorf("failed to write report %s: %w", output, err)
+		}
+	}
+	if format == "json" {
+		return report.WriteJSON(os.Stdout)
+	}
+	return report.WriteTable(os.Stdout)
+}
+
+// newKnowledgeService creates the ingestion service used by the API. Documents are stored
+// without embeddings when no embedder is configured, and the agentic strategy needs an LLM client
+func newKnowledgeService(dbPool *pgxpool.Pool) *knowledge.Service {
+	embedder, err := agent.NewEmbedder(agent.EmbeddingProvider)
+	if err != nil {
+		log.Printf("Uploaded documents will not be embedded: %v", err)
+		embedder = nil
+	}
+	service := knowledge.NewService(dbPool, embedder)
+	llm, err := agent.NewLLMClient(database.ModelProviderOpenAI)
+	if err != nil {
+		log.Printf("Agentic chunking is disabled: %v", err)
+		return service
 	}
+	service.SetChunkingLLM(llm, agent.GLM_4_5_AIR)
+	return service
+}
 
+// connectDB creates the database connection pool and runs the migrations
+func connectDB(ctx context.Context) (*pgxpool.Pool, error) {
 	dbUrl := "postgres://" + os.Getenv("DB_USERNAME") + ":" + url.QueryEscape(os.Getenv("DB_PASSWORD")) + "@" + os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT") + "/" + os.Getenv("DB_DATABASE") + "?sslmode=disable"
 
 	// Create a database connection pool
 	poolConfig, err := pgxpool.ParseConfig(dbUrl)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse database URL: %v", err)
+		return nil, fmt.Errorf("failed to parse database URL: %v", err)
 	}
 	poolConfig.MaxConns = 10
 
 	dbPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create database pool: %v", err)
+		return nil, fmt.Errorf("failed to create database pool: %v", err)
 	}
 
 	// Test the database connection
 	err = dbPool.Ping(ctx)
 	if err != nil {
 		log.Printf("Failed to ping database: %v", err)
-		return nil, nil, err
+		dbPool.Close()
+		return nil, err
 	}
 
 	// Run Migration
 	err = database.MigrateDB(dbPool)
 	if err != nil {
 		log.Println("Failed to migrate database", "error", err)
-		return nil, nil, err
+		dbPool.Close()
+		return nil, err
 	}
 	log.Println("Database connection established")
+	return dbPool, nil
+}
+
+func runServer(ctx context.Context, port string, mcpProtocol string) (context.Context, func(), error) {
+	log.Printf("Running server on port: %s", port)
+
+	dbPool, err := connectDB(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mcpShutdown func()
+	if mcpProtocol == "http" {
+		// Create MCP service and HTTP server
+		log.Printf("Initializing MCP server with HTTP protocol on 0.0.0.0:8081")
+		err := mcp.Start(ctx, mcpProtocol, agent.NewDefaultKnowledgeSearcher(database.New(dbPool)))
+		if err != nil {
+			log.Printf("Failed to start MCP: %v", err)
+			return nil, nil, err
+		}
+	}
 
 	// Create an agent service
-	agent, err := agent.NewService(ctx, dbPool, database.ModelProviderOpenAI)
+	agent, err := agent.NewService(ctx, dbPool)
 	if err != nil {
 		log.Println("Failed to create agent service", "error", err)
 		return nil, nil, err
 	}
 
 	// Create a server for the application
-	server := server.NewServer(dbPool, agent, port)
+	server := server.NewServer(dbPool, agent, newKnowledgeService(dbPool), port)
 	runContext, cancel := context.WithCancel(ctx)
 
 	// Create a done channel to signal when the shutdown is complete
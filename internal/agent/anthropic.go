@@ -0,0 +1,320 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"stockmind/internal/database"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/bedrock"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultAnthropicMaxTokens is sent when the agent config leaves maxTokens unset, the Messages API requires it
+const defaultAnthropicMaxTokens = 4096
+
+func createAnthropicClient(ctx context.Context, config AnthropicConfig) (*LLMClientWrapper, error) {
+	var client anthropic.Client
+	switch config.AuthType {
+	case "api_key", "":
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY is not found")
+		}
+		client = anthropic.NewClient(option.WithAPIKey(config.APIKey))
+	case "aws":
+		awsCfg, err := loadAWSConfig(ctx, config.AWS)
+		if err != nil {
+			return nil, err
+		}
+		// Bedrock signs the requests with the AWS credentials instead of an API key
+		client = anthropic.NewClient(bedrock.WithConfig(awsCfg))
+	default:
+		return nil, fmt.Errorf("unsupported auth type for Anthropic: %s", config.AuthType)
+	}
+	return &LLMClientWrapper{OfAnthropic: &client}, nil
+}
+
+// loadAWSConfig loads the default AWS credential chain (environment, shared config, instance role)
+// and, for assume_role, exchanges it for temporary credentials of the configured role
+func loadAWSConfig(ctx context.Context, config AWSCredentialConfig) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if config.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(config.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	switch config.Type {
+	case "default", "":
+	case "assume_role":
+		if config.RoleARN == "" {
+			return aws.Config{}, fmt.Errorf("roleArn is required for the assume_role AWS credential type")
+		}
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), config.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if config.Duration > 0 {
+				o.Duration = time.Duration(config.Duration) * time.Second
+			}
+			if config.RoleSessionName != "" {
+				o.RoleSessionName = config.RoleSessionName
+			}
+		})
+		// The cache refreshes the temporary credentials before they expire
+		awsCfg.Credentials = aws.NewCredentialsCache(provider)
+	default:
+		return aws.Config{}, fmt.Errorf("unsupported AWS credential type: %s", config.Type)
+	}
+	return awsCfg, nil
+}
+
+func (a *Agent) newAnthropicMessage(retrieved []ScoredChunk) (anthropic.MessageNewParams, error) {
+	request := anthropic.MessageNewParams{
+		Model:     anthropic.Model(a.config.ModelID),
+		MaxTokens: a.config.MaxTokens,
+	}
+	if request.MaxTokens <= 0 {
+		request.MaxTokens = defaultAnthropicMaxTokens
+	}
+	if system := withRetrievedContext(a.config.SystemPrompt, retrieved); system != "" {
+		request.System = []anthropic.TextBlockParam{{Text: system}}
+	}
+	// Extended thinking only accepts the default temperature and no top_k, see validateAgentConfig
+	if a.config.ThinkingToken > 0 {
+		request.Thinking = anthropic.ThinkingConfigParamOfEnabled(a.config.ThinkingToken)
+	} else {
+		if a.config.Temperature != nil {
+			request.Temperature = anthropic.Float(*a.config.Temperature)
+		}
+		if a.config.TopK > 0 {
+			request.TopK = anthropic.Int(a.config.TopK)
+		}
+	}
+	if a.config.TopP > 0 {
+		request.TopP = anthropic.Float(a.config.TopP)
+	}
+
+	for _, tool := range a.tools {
+		schema, err := anthropicInputSchema(tool)
+		if err != nil {
+			return request, fmt.Errorf("invalid input schema of tool %s: %w", tool.Name, err)
+		}
+		request.Tools = append(request.Tools, anthropic.ToolUnionParam{
+			OfTool: &anthropic.ToolParam{
+				Name:        tool.Name,
+				Description: anthropic.String(tool.Description),
+				InputSchema: schema,
+			},
+		})
+	}
+	return request, nil
+}
+
+// anthropicInputSchema converts the JSON schema of an MCP tool. Keywords other than
+// properties and required, such as $defs, are passed through unchanged.
+func anthropicInputSchema(tool mcp.Tool) (anthropic.ToolInputSchemaParam, error) {
+	raw := tool.RawInputSchema
+	if len(raw) == 0 {
+		var err error
+		if raw, err = json.Marshal(tool.InputSchema); err != nil {
+			return anthropic.ToolInputSchemaParam{}, err
+		}
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return anthropic.ToolInputSchemaParam{}, err
+	}
+	var schema anthropic.ToolInputSchemaParam
+	schema.Properties = fields["properties"]
+	if required, ok := fields["required"].([]any); ok {
+		for _, name := range required {
+			if s, ok := name.(string); ok {
+				schema.Required = append(schema.Required, s)
+			}
+		}
+	}
+	delete(fields, "type")
+	delete(fields, "properties")
+	delete(fields, "required")
+	if len(fields) > 0 {
+		schema.ExtraFields = fields
+	}
+	return schema, nil
+}
+
+func anthropicToDbStopReason(reason anthropic.StopReason) database.StopReason {
+	switch reason {
+	case anthropic.StopReasonMaxTokens: // Max tokens
+		return database.StopReasonMaxTokens
+	case anthropic.StopReasonToolUse: // Tool call
+		return database.StopReasonToolCall
+	case anthropic.StopReasonEndTurn, anthropic.StopReasonStopSequence, anthropic.StopReasonRefusal: // End Turn
+		return database.StopReasonAgentDone
+	default:
+		return database.StopReasonUnknown
+	}
+}
+
+func (a *Agent) completionAnthropic(ctx context.Context, messages []*database.MessageUnion, retrieved []ScoredChunk, callback ChatCallBack) (database.MessageUnion, database.StopReason, error) {
+	result := database.MessageUnion{}
+	// Prepare messages for Anthropic, grounding the system prompt in the knowledge base
+	body, err := a.newAnthropicMessage(retrieved)
+	if err != nil {
+		return result, database.StopReasonNil, err
+	}
+	body.Messages = anthropicMessages(messages)
+	// Call Anthropic API
+	if a.provider == nil || a.provider.OfAnthropic == nil {
+		return result, database.StopReasonNil, fmt.Errorf("anthropic client is not initialized")
+	}
+	// Retries are made by Completion according to the retry policy of the agent
+	stream := a.provider.OfAnthropic.Messages.NewStreaming(ctx, body, option.WithMaxRetries(0))
+	defer stream.Close()
+
+	// Accumulate the events into the complete message while forwarding text and thinking deltas
+	message := anthropic.Message{}
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return result, database.StopReasonNil, fmt.Errorf("failed to accumulate message stream: %w", err)
+		}
+		if callback == nil {
+			continue
+		}
+		var err error
+		switch event := event.AsAny().(type) {
+		case anthropic.ContentBlockDeltaEvent:
+			switch delta := event.Delta.AsAny().(type) {
+			case anthropic.TextDelta:
+				err = callback(delta.Text, false, false)
+			case anthropic.ThinkingDelta:
+				err = callback(delta.Thinking, true, false)
+			}
+		case anthropic.ContentBlockStopEvent:
+			if event.Index < int64(len(message.Content)) {
+				switch message.Content[event.Index].Type {
+				case "text":
+					err = callback("", false, true)
+				case "thinking":
+					err = callback("", true, true)
+				}
+			}
+		}
+		if err != nil {
+			return result, database.StopReasonNil, err
+		}
+	}
+	if err := stream.Err(); err != nil {
+		fmt.Printf("\nStream error: %v\n", err)
+		return result, database.StopReasonNil, err
+	}
+	fmt.Println("Stream finished", "stop_reason", message.StopReason, "input_tokens", message.Usage.InputTokens, "output_tokens", message.Usage.OutputTokens)
+
+	param := message.ToParam()
+	result.OfAnthropic = &param
+	return result, anthropicToDbStopReason(message.StopReason), nil
+}
+
+func (a *Agent) toolUseAnthropic(ctx context.Context, message *database.MessageUnion) ([]database.MessageUnion, error) {
+	lastMessage := message.OfAnthropic
+	if lastMessage == nil {
+		return nil, fmt.Errorf("last message is not an Anthropic message")
+	}
+	// Find the tool use blocks
+	calls := []toolCall{}
+	for _, block := range lastMessage.Content {
+		if toolUse := block.OfToolUse; toolUse != nil {
+			calls = append(calls, toolCall{ID: toolUse.ID, Name: toolUse.Name, Arguments: toolUse.Input})
+		}
+	}
+	if len(calls) == 0 {
+		fmt.Println("No tool use blocks found in chat history", "sessionId", a.session.ID, "agentName", a.name)
+		return nil, fmt.Errorf("no tool use blocks found in chat history")
+	}
+	toolResponses, err := a.callTools(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anthropic expects every tool result of the turn in the next user message
+	toolResults := make([]anthropic.ContentBlockParamUnion, 0, len(calls))
+	for i, call := range calls {
+		toolResult := anthropicToolResult(call, toolResponses[i])
+		toolResults = append(toolResults, anthropic.ContentBlockParamUnion{OfToolResult: &toolResult})
+	}
+	toolResultMessage := anthropic.NewUserMessage(toolResults...)
+	return []database.MessageUnion{{OfAnthropic: &toolResultMessage}}, nil
+}
+
+// anthropicImageTypes are the image media types the Messages API accepts
+var anthropicImageTypes = map[string]bool{
+	string(anthropic.Base64ImageSourceMediaTypeImageJPEG): true,
+	string(anthropic.Base64ImageSourceMediaTypeImagePNG):  true,
+	string(anthropic.Base64ImageSourceMediaTypeImageGIF):  true,
+	string(anthropic.Base64ImageSourceMediaTypeImageWebP): true,
+}
+
+// anthropicToolResult converts the result of a tool call to a tool_result block, keeping
+// images and PDF documents as such
+func anthropicToolResult(call toolCall, toolResponse *mcp.CallToolResult) anthropic.ToolResultBlockParam {
+	toolResult := anthropic.ToolResultBlockParam{
+		ToolUseID: call.ID,
+		Content:   []anthropic.ToolResultBlockParamContentUnion{},
+	}
+	if toolResponse.IsError {
+		toolResult.IsError = anthropic.Bool(true)
+	}
+	text := func(text string) {
+		toolResult.Content = append(toolResult.Content, anthropic.ToolResultBlockParamContentUnion{OfText: &anthropic.TextBlockParam{Text: text}})
+	}
+	image := func(data, mimeType string) {
+		if !anthropicImageTypes[mimeType] {
+			text(omittedContentText("image", mimeType))
+			return
+		}
+		block := anthropic.NewImageBlockBase64(mimeType, data)
+		toolResult.Content = append(toolResult.Content, anthropic.ToolResultBlockParamContentUnion{OfImage: block.OfImage})
+	}
+
+	for _, content := range toolResponse.Content {
+		switch content := content.(type) {
+		case mcp.TextContent:
+			text(content.Text)
+		case mcp.ImageContent:
+			image(content.Data, content.MIMEType)
+		case mcp.AudioContent:
+			text(omittedContentText("audio", content.MIMEType))
+		case mcp.ResourceLink:
+			text(resourceLinkText(content))
+		case mcp.EmbeddedResource:
+			switch resource := content.Resource.(type) {
+			case mcp.TextResourceContents:
+				text(resourceText(resource))
+			case mcp.BlobResourceContents:
+				switch {
+				case strings.HasPrefix(resource.MIMEType, "image/"):
+					image(resource.Blob, resource.MIMEType)
+				case resource.MIMEType == "application/pdf":
+					block := anthropic.NewDocumentBlock(anthropic.Base64PDFSourceParam{Data: resource.Blob})
+					block.OfDocument.Title = anthropic.String(resource.URI)
+					toolResult.Content = append(toolResult.Content, anthropic.ToolResultBlockParamContentUnion{OfDocument: block.OfDocument})
+				default:
+					text(omittedContentText("resource "+resource.URI, resource.MIMEType))
+				}
+			}
+		}
+	}
+	if structured, ok := structuredContentText(toolResponse); ok {
+		text(structured)
+	}
+	return toolResult
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"testing"
+
+	"stockmind/internal/database"
+)
+
+func TestNewAnthropicMessageSampling(t *testing.T) {
+	temperature := 0.0
+	tests := []struct {
+		name            string
+		cfg             database.AgentConfig
+		wantTemperature bool
+		wantTopP        bool
+	}{
+		{name: "unset temperature is left to the API", cfg: database.AgentConfig{}},
+		{name: "temperature of zero is sent", cfg: database.AgentConfig{Temperature: &temperature}, wantTemperature: true},
+		{name: "topP alone", cfg: database.AgentConfig{TopP: 0.9}, wantTopP: true},
+		{name: "thinking drops the temperature", cfg: database.AgentConfig{Temperature: &temperature, ThinkingToken: 2048}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{config: tt.cfg}
+			request, err := a.newAnthropicMessage(nil)
+			if err != nil {
+				t.Fatalf("newAnthropicMessage() returned %v", err)
+			}
+			if request.Temperature.Valid() != tt.wantTemperature {
+				t.Errorf("temperature sent = %v, want %v", request.Temperature.Valid(), tt.wantTemperature)
+			}
+			if request.TopP.Valid() != tt.wantTopP {
+				t.Errorf("top_p sent = %v, want %v", request.TopP.Valid(), tt.wantTopP)
+			}
+		})
+	}
+}
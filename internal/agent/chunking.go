@@ -1,15 +1,115 @@
 package agent
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChunkingStrategy names one of the Chunking methods so it can be selected from configuration
+type ChunkingStrategy string
+
+const (
+	ChunkingStrategyFixedSize                 ChunkingStrategy = "fixed_size"
+	ChunkingStrategyFixedSizeByWord           ChunkingStrategy = "fixed_size_by_word"
+	ChunkingStrategyFixedSizeWithTokenization ChunkingStrategy = "fixed_size_tokenized"
+	ChunkingStrategyRecursive                 ChunkingStrategy = "recursive"
+	ChunkingStrategyRecursiveWithTokenization ChunkingStrategy = "recursive_tokenized"
+	ChunkingStrategySemantic                  ChunkingStrategy = "semantic"
+	ChunkingStrategyAgentic                   ChunkingStrategy = "agentic"
+	ChunkingStrategyStructural                ChunkingStrategy = "structural"
+)
+
+// Valid reports whether s names a chunking strategy. The empty strategy is valid and means recursive
+func (s ChunkingStrategy) Valid() bool {
+	switch s {
+	case ChunkingStrategyFixedSize, ChunkingStrategyFixedSizeByWord, ChunkingStrategyFixedSizeWithTokenization,
+		ChunkingStrategyRecursive, ChunkingStrategyRecursiveWithTokenization, ChunkingStrategySemantic,
+		ChunkingStrategyAgentic, ChunkingStrategyStructural, "":
+		return true
+	}
+	return false
+}
+
+// SeparatorLevel is the kind of boundary a chunk was cut at
+type SeparatorLevel string
+
+const (
+	SeparatorLevelParagraph SeparatorLevel = "paragraph"
+	SeparatorLevelLine      SeparatorLevel = "line"
+	SeparatorLevelSentence  SeparatorLevel = "sentence"
+	SeparatorLevelWord      SeparatorLevel = "word"
+	SeparatorLevelCharacter SeparatorLevel = "character"
+	SeparatorLevelToken     SeparatorLevel = "token"
+	SeparatorLevelSection   SeparatorLevel = "section"
+	SeparatorLevelTable     SeparatorLevel = "table"
 )
 
+// Chunk is a piece of a source text. Start and End are byte offsets into the source text
+// (after invalid UTF-8 has been replaced) and Text is usually text[Start:End]; strategies
+// that add context, such as the section title of AgenticChunking, prefix it to Text.
+type Chunk struct {
+	Text  string         `json:"text"`
+	Start int            `json:"start"`
+	End   int            `json:"end"`
+	Index int            `json:"index"`
+	Level SeparatorLevel `json:"level"`
+}
+
+// ChunkTexts returns the text of each chunk
+func ChunkTexts(chunks []Chunk) []string {
+	texts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	return texts
+}
+
+func newChunk(text string, start, end int, level SeparatorLevel) Chunk {
+	return Chunk{Text: text[start:end], Start: start, End: end, Level: level}
+}
+
+// indexChunks numbers chunks in order
+func indexChunks(chunks []Chunk) []Chunk {
+	for i := range chunks {
+		chunks[i].Index = i
+	}
+	return chunks
+}
+
+// shiftChunks moves the offsets of chunks cut from a substring starting at offset
+func shiftChunks(chunks []Chunk, offset int) []Chunk {
+	for i := range chunks {
+		chunks[i].Start += offset
+		chunks[i].End += offset
+	}
+	return chunks
+}
+
+// DefaultBreakpointPercentile is the similarity percentile below which SemanticChunking starts a new chunk
+const DefaultBreakpointPercentile = 10.0
+
 type Chunking struct {
 	// chunkSize is the size of the chunk
 	chunkSize int
 	// overlap is the overlap between chunks
 	overlap int
+	// embedder embeds sentences for SemanticChunking
+	embedder Embedder
+	// breakpointPercentile is the percentile of adjacent sentence similarities below which a new chunk starts
+	breakpointPercentile float64
+	// llm and llmModel propose the sections of AgenticChunking
+	llm      *LLMClientWrapper
+	llmModel string
+	// tokenizer measures chunks for the strategies with tokenization
+	tokenizer Tokenizer
 }
 
 // NewChunking creates a new Chunking instance with validation
@@ -24,28 +124,82 @@ func NewChunking(chunkSize, overlap int) (*Chunking, error) {
 		return nil, errors.New("overlap must be < chunk_size")
 	}
 	return &Chunking{
-		chunkSize: chunkSize,
-		overlap:   overlap,
+		chunkSize:            chunkSize,
+		overlap:              overlap,
+		breakpointPercentile: DefaultBreakpointPercentile,
 	}, nil
 }
 
-func (c *Chunking) FixedSizeChunking(text string) []string {
-	step := c.chunkSize - c.overlap
-	if step <= 0 {
-		return nil
+// SetEmbedder configures the embedder and breakpoint percentile (0-100) used by SemanticChunking
+func (c *Chunking) SetEmbedder(embedder Embedder, breakpointPercentile float64) error {
+	if embedder == nil {
+		return errors.New("embedder is required")
 	}
+	if breakpointPercentile < 0 || breakpointPercentile > 100 {
+		return errors.New("breakpoint_percentile must be between 0 and 100")
+	}
+	c.embedder = embedder
+	c.breakpointPercentile = breakpointPercentile
+	return nil
+}
 
-	var chunks []string
-	for i := 0; i < len(text); i += step {
-		end := min(i+c.chunkSize, len(text))
-		chunks = append(chunks, text[i:end])
+// SetLLM configures the model used by AgenticChunking
+func (c *Chunking) SetLLM(llm *LLMClientWrapper, model string) error {
+	if llm == nil {
+		return errors.New("llm client is required")
+	}
+	if model == "" {
+		return errors.New("llm model is required")
+	}
+	c.llm = llm
+	c.llmModel = model
+	return nil
+}
+
+// SetTokenizer configures the tokenizer used by the strategies with tokenization
+func (c *Chunking) SetTokenizer(tokenizer Tokenizer) error {
+	if tokenizer == nil {
+		return errors.New("tokenizer is required")
+	}
+	c.tokenizer = tokenizer
+	return nil
+}
+
+// Split chunks text with the given strategy. An empty strategy means RecursiveChunking
+func (c *Chunking) Split(ctx context.Context, strategy ChunkingStrategy, text string) ([]Chunk, error) {
+	switch strategy {
+	case ChunkingStrategyFixedSize:
+		return c.FixedSizeChunking(text), nil
+	case ChunkingStrategyFixedSizeByWord:
+		return c.FixedSizeByWordChunking(text), nil
+	case ChunkingStrategyFixedSizeWithTokenization:
+		return c.FixedSizeChunkingWithTokenization(text)
+	case ChunkingStrategyRecursive, "":
+		return c.RecursiveChunking(text), nil
+	case ChunkingStrategyRecursiveWithTokenization:
+		return c.RecursiveChunkingWithTokenization(text)
+	case ChunkingStrategySemantic:
+		return c.SemanticChunking(ctx, text)
+	case ChunkingStrategyAgentic:
+		return c.AgenticChunking(ctx, text)
+	case ChunkingStrategyStructural:
+		return c.StructuralChunking(text), nil
+	default:
+		return nil, fmt.Errorf("unsupported chunking strategy: %s", strategy)
 	}
-	return chunks
 }
 
-func (c *Chunking) FixedSizeByWordChunking(text string) []string {
+// FixedSizeChunking splits text into windows of chunkSize characters. Windows are cut
+// between grapheme clusters, so a letter and its combining diacritics are never separated.
+func (c *Chunking) FixedSizeChunking(text string) []Chunk {
+	text = toValidUTF8(text)
+	return c.windowChunks(text, graphemeOffsets(text), SeparatorLevelCharacter)
+}
+
+func (c *Chunking) FixedSizeByWordChunking(text string) []Chunk {
 	// Split text into words
-	words := strings.Fields(text)
+	text = toValidUTF8(text)
+	words := wordSpans(text)
 	if len(words) == 0 {
 		return nil
 	}
@@ -55,160 +209,209 @@ func (c *Chunking) FixedSizeByWordChunking(text string) []string {
 		return nil
 	}
 
-	var chunks []string
+	var chunks []Chunk
 	for i := 0; i < len(words); i += step {
 		end := min(i+c.chunkSize, len(words))
-		chunkWords := words[i:end]
-		chunks = append(chunks, strings.Join(chunkWords, " "))
+		chunks = append(chunks, newChunk(text, words[i].start, words[end-1].end, SeparatorLevelWord))
 	}
-	return chunks
+	return indexChunks(chunks)
+}
+
+// FixedSizeChunkingWithTokenization splits text into windows of chunkSize tokens
+func (c *Chunking) FixedSizeChunkingWithTokenization(text string) ([]Chunk, error) {
+	if c.tokenizer == nil {
+		return nil, errors.New("fixed size chunking with tokenization requires a tokenizer")
+	}
+	text = toValidUTF8(text)
+	return c.windowChunks(text, tokenBoundaries(c.tokenizer, text), SeparatorLevelToken), nil
 }
 
-func (c *Chunking) FixedSizeChunkingWithTokenization(text string) []string {
-	tokens := strings.Fields(text)
+// windowChunks cuts text into windows of chunkSize units, moving chunkSize-overlap units at a
+// time. offsets are the byte offsets of the unit boundaries, from 0 to len(text).
+func (c *Chunking) windowChunks(text string, offsets []int, level SeparatorLevel) []Chunk {
 	step := c.chunkSize - c.overlap
 	if step <= 0 {
 		return nil
 	}
 
-	var chunks []string
-	for i := 0; i < len(tokens); i += step {
-		end := min(i+c.chunkSize, len(tokens))
-		chunkTokens := tokens[i:end]
-		chunks = append(chunks, strings.Join(chunkTokens, " "))
+	units := len(offsets) - 1
+	var chunks []Chunk
+	for i := 0; i < units; i += step {
+		end := windowEnd(offsets, i, c.chunkSize)
+		// Windows starting inside the same character are the same window
+		if offsets[i] < offsets[end] && (len(chunks) == 0 || chunks[len(chunks)-1].Start != offsets[i]) {
+			chunks = append(chunks, newChunk(text, offsets[i], offsets[end], level))
+		}
 	}
-	return chunks
+	return indexChunks(chunks)
+}
+
+// windowEnd returns the index of the offset ending a window of size units that starts at
+// offsets[i]. An offset repeats when a character spans several tokens; the units of a character
+// before i belong to the window too. A window holds at least one character, even a larger one.
+func windowEnd(offsets []int, i, size int) int {
+	units := len(offsets) - 1
+	first := i
+	for first > 0 && offsets[first-1] == offsets[i] {
+		first--
+	}
+	end := min(first+size, units)
+	for end < units && offsets[end] <= offsets[i] {
+		end++
+	}
+	return end
+}
+
+// lengthMeasure abstracts how recursive chunking measures and cuts text, in characters or in tokens
+type lengthMeasure struct {
+	length func(s string) int
+	// boundaries returns the byte offsets at which s may be cut, one per unit, from 0 to len(s)
+	boundaries func(s string) []int
+}
+
+// charMeasure measures text in characters (grapheme clusters) and only cuts between them
+var charMeasure = lengthMeasure{
+	length:     charCount,
+	boundaries: graphemeOffsets,
+}
+
+// tokenMeasure measures text in tokens of the configured tokenizer
+func (c *Chunking) tokenMeasure() lengthMeasure {
+	return lengthMeasure{
+		length: c.tokenizer.Count,
+		boundaries: func(s string) []int {
+			return tokenBoundaries(c.tokenizer, s)
+		},
+	}
+}
+
+// RecursiveChunking splits text at paragraphs, then lines, sentences and words until every
+// chunk fits in chunkSize characters
+func (c *Chunking) RecursiveChunking(text string) []Chunk {
+	return c.recursiveChunking(toValidUTF8(text), charMeasure)
 }
 
-func (c *Chunking) RecursiveChunking(text string) []string {
-	var chunks []string
+// RecursiveChunkingWithTokenization is RecursiveChunking with chunkSize and overlap counted in tokens
+func (c *Chunking) RecursiveChunkingWithTokenization(text string) ([]Chunk, error) {
+	if c.tokenizer == nil {
+		return nil, errors.New("recursive chunking with tokenization requires a tokenizer")
+	}
+	return c.recursiveChunking(toValidUTF8(text), c.tokenMeasure()), nil
+}
 
-	appendChunk := func(s string) {
-		if s == "" {
+func (c *Chunking) recursiveChunking(text string, m lengthMeasure) []Chunk {
+	var chunks []Chunk
+
+	appendChunk := func(start, end int, level SeparatorLevel) {
+		s := trimSpan(text, textSpan{start, end})
+		if s.start >= s.end {
 			return
 		}
-		chunks = append(chunks, s)
+		chunks = append(chunks, newChunk(text, s.start, s.end, level))
 	}
 
-	// Helper function to add overlap between chunks
+	// cutSpan splits text[start:end] into pieces of at most chunkSize units
+	cutSpan := func(start, end int) {
+		offsets := m.boundaries(text[start:end])
+		for i := 0; i < len(offsets)-1; {
+			j := windowEnd(offsets, i, c.chunkSize)
+			appendChunk(start+offsets[i], start+offsets[j], SeparatorLevelCharacter)
+			i = j
+		}
+	}
+
+	// Helper function to add overlap between chunks. The span of every chunk is widened
+	// to include the last overlap units of the previous chunk and the first of the next one.
 	addOverlapToChunks := func() {
 		if c.overlap == 0 || len(chunks) <= 1 {
 			return
 		}
 
-		var overlappedChunks []string
+		overlappedChunks := make([]Chunk, 0, len(chunks))
 		for i := 0; i < len(chunks); i++ {
-			currentChunk := chunks[i]
+			start, end := chunks[i].Start, chunks[i].End
 
 			// Add overlap from previous chunk
 			if i > 0 {
 				prevChunk := chunks[i-1]
-				if len(prevChunk) >= c.overlap {
-					overlapText := prevChunk[len(prevChunk)-c.overlap:]
-					currentChunk = overlapText + " " + currentChunk
+				if m.length(prevChunk.Text) >= c.overlap {
+					offsets := m.boundaries(prevChunk.Text)
+					start = min(start, prevChunk.Start+offsets[len(offsets)-1-c.overlap])
 				}
 			}
 
 			// Add overlap from next chunk
 			if i < len(chunks)-1 {
 				nextChunk := chunks[i+1]
-				if len(nextChunk) >= c.overlap {
-					overlapText := nextChunk[:c.overlap]
-					currentChunk = currentChunk + " " + overlapText
+				if m.length(nextChunk.Text) >= c.overlap {
+					offsets := m.boundaries(nextChunk.Text)
+					end = max(end, nextChunk.Start+offsets[c.overlap])
 				}
 			}
 
-			overlappedChunks = append(overlappedChunks, currentChunk)
+			overlappedChunks = append(overlappedChunks, newChunk(text, start, end, chunks[i].Level))
 		}
 		chunks = overlappedChunks
 	}
 
-	packWords := func(words []string) {
-		current := ""
+	packWords := func(words []textSpan) {
+		current := textSpan{start: -1}
 		for _, w := range words {
-			if current == "" {
-				if len(w) <= c.chunkSize {
+			if current.start < 0 {
+				if m.length(text[w.start:w.end]) <= c.chunkSize {
 					current = w
 				} else {
-					for start := 0; start < len(w); start += c.chunkSize {
-						end := min(start+c.chunkSize, len(w))
-						appendChunk(w[start:end])
-					}
-					current = ""
+					cutSpan(w.start, w.end)
 				}
 				continue
 			}
-			if len(current)+1+len(w) <= c.chunkSize {
-				current += " " + w
+			if m.length(text[current.start:w.end]) <= c.chunkSize {
+				current.end = w.end
 			} else {
-				appendChunk(current)
-				if len(w) <= c.chunkSize {
+				appendChunk(current.start, current.end, SeparatorLevelWord)
+				if m.length(text[w.start:w.end]) <= c.chunkSize {
 					current = w
 				} else {
-					for start := 0; start < len(w); start += c.chunkSize {
-						end := min(start+c.chunkSize, len(w))
-						appendChunk(w[start:end])
-					}
-					current = ""
+					cutSpan(w.start, w.end)
+					current = textSpan{start: -1}
 				}
 			}
 		}
-		if current != "" {
-			appendChunk(current)
+		if current.start >= 0 {
+			appendChunk(current.start, current.end, SeparatorLevelWord)
 		}
 	}
 
 	// "\n\n" - Double new line, commonly indicating paragraph breaks
-	paragraphs := strings.Split(text, "\n\n")
-	for _, p := range paragraphs {
-		if p == "" {
-			continue
-		}
-		if len(p) <= c.chunkSize {
-			appendChunk(p)
+	for _, p := range splitSpans(text, textSpan{0, len(text)}, "\n\n") {
+		if m.length(text[p.start:p.end]) <= c.chunkSize {
+			appendChunk(p.start, p.end, SeparatorLevelParagraph)
 			continue
 		}
 
 		// "\n" - Single new line, often used for line breaks
-		lines := strings.Split(p, "\n")
-		for _, line := range lines {
-			if line == "" {
-				continue
-			}
-			if len(line) <= c.chunkSize {
-				appendChunk(line)
+		for _, line := range splitSpans(text, p, "\n") {
+			if m.length(text[line.start:line.end]) <= c.chunkSize {
+				appendChunk(line.start, line.end, SeparatorLevelLine)
 				continue
 			}
 
-			// "." - Period, commonly used for sentence breaks
-			raw := strings.Split(line, ".")
-			sentences := make([]string, 0, len(raw))
-			for i, s := range raw {
-				if s == "" {
-					continue
-				}
-
-				if i < len(raw)-1 || strings.HasSuffix(line, ".") {
-					sentences = append(sentences, s+".")
-				} else {
-					sentences = append(sentences, s)
-				}
-			}
-
-			for _, s := range sentences {
-				if len(s) <= c.chunkSize {
-					appendChunk(s)
+			// "." - Period, commonly used for sentence breaks. The period stays with its sentence
+			for _, s := range periodSpans(text, line) {
+				if m.length(text[s.start:s.end]) <= c.chunkSize {
+					appendChunk(s.start, s.end, SeparatorLevelSentence)
 					continue
 				}
 				// " " - Words
-				words := strings.Fields(s)
+				words := wordSpans(text[s.start:s.end])
 				if len(words) == 0 {
-					for start := 0; start < len(s); start += c.chunkSize {
-						end := min(start+c.chunkSize, len(s))
-						appendChunk(s[start:end])
-					}
+					cutSpan(s.start, s.end)
 					continue
 				}
+				for i := range words {
+					words[i].start += s.start
+					words[i].end += s.start
+				}
 				packWords(words)
 			}
 		}
@@ -217,18 +420,361 @@ func (c *Chunking) RecursiveChunking(text string) []string {
 	// Apply overlap after all chunks are created
 	addOverlapToChunks()
 
-	return chunks
+	return indexChunks(chunks)
 }
 
-func (c *Chunking) RecursiveChunkingWithTokenization(text string) []string {
-	var chunks []string
-	return chunks
+// SemanticChunking splits text into sentences and groups adjacent sentences while they stay
+// semantically close. A new chunk starts where the cosine similarity between two adjacent
+// sentences falls below the configured percentile of all adjacent similarities, or when the
+// chunk would exceed chunkSize.
+func (c *Chunking) SemanticChunking(ctx context.Context, text string) ([]Chunk, error) {
+	if c.embedder == nil {
+		return nil, errors.New("semantic chunking requires an embedder")
+	}
+	text = toValidUTF8(text)
+	sentences := sentenceSpans(text)
+	if len(sentences) == 0 {
+		return nil, nil
+	}
+	vectors, err := c.embedder.Embed(ctx, spanTexts(text, sentences))
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed sentences: %w", err)
+	}
+	if len(vectors) != len(sentences) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d sentences", len(vectors), len(sentences))
+	}
+	similarities := make([]float64, 0, len(sentences)-1)
+	for i := 0; i < len(sentences)-1; i++ {
+		similarities = append(similarities, cosineSimilarity(vectors[i], vectors[i+1]))
+	}
+	threshold := percentile(similarities, c.breakpointPercentile)
+
+	// Sentences longer than chunkSize are split without overlap so they still honour the ceiling
+	splitter := &Chunking{chunkSize: c.chunkSize}
+
+	var chunks []Chunk
+	current := textSpan{start: -1}
+	flush := func() {
+		if current.start >= 0 {
+			chunks = append(chunks, newChunk(text, current.start, current.end, SeparatorLevelSentence))
+			current = textSpan{start: -1}
+		}
+	}
+	for i, sentence := range sentences {
+		if i > 0 && similarities[i-1] < threshold {
+			flush()
+		}
+		if charCount(text[sentence.start:sentence.end]) > c.chunkSize {
+			flush()
+			chunks = append(chunks, shiftChunks(splitter.RecursiveChunking(text[sentence.start:sentence.end]), sentence.start)...)
+			continue
+		}
+		if current.start < 0 {
+			current = sentence
+			continue
+		}
+		if charCount(text[current.start:sentence.end]) > c.chunkSize {
+			flush()
+			current = sentence
+			continue
+		}
+		current.end = sentence.end
+	}
+	flush()
+	return indexChunks(chunks), nil
+}
+
+const agenticChunkingPrompt = `You split documents into sections for a retrieval system.
+The document is given as numbered sentences. Group consecutive sentences into sections that each cover a single topic, and give every section a short descriptive title in the language of the document.
+Sections must be contiguous, cover every sentence exactly once and keep the original order.
+Answer with JSON only, in the form {"sections": [{"title": "...", "start": 0, "end": 3}]} where start and end are the inclusive sentence numbers.`
+
+type agenticSection struct {
+	Title string `json:"title"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// AgenticChunking asks the configured LLM to propose topic coherent sections of the text.
+// Each section becomes a chunk prefixed with its title; sections longer than chunkSize are split
+// further. When the model output is malformed it falls back to RecursiveChunking.
+func (c *Chunking) AgenticChunking(ctx context.Context, text string) ([]Chunk, error) {
+	if c.llm == nil || c.llm.OfOpenAI == nil {
+		return nil, errors.New("agentic chunking requires an OpenAI compatible llm client")
+	}
+	text = toValidUTF8(text)
+	sentences := sentenceSpans(text)
+	if len(sentences) == 0 {
+		return nil, nil
+	}
+
+	var numbered strings.Builder
+	for i, sentence := range sentences {
+		fmt.Fprintf(&numbered, "[%d] %s\n", i, text[sentence.start:sentence.end])
+	}
+	resp, err := c.llm.OfOpenAI.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: c.llmModel,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: agenticChunkingPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: numbered.String()},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request sections from llm: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		fmt.Println("LLM returned no choices, falling back to recursive chunking", "model", c.llmModel)
+		return c.RecursiveChunking(text), nil
+	}
+	sections, err := parseAgenticSections(resp.Choices[0].Message.Content, len(sentences))
+	if err != nil {
+		fmt.Println("Invalid sections proposed by LLM, falling back to recursive chunking", "model", c.llmModel, "error", err)
+		return c.RecursiveChunking(text), nil
+	}
+
+	var chunks []Chunk
+	for _, section := range sections {
+		title := strings.TrimSpace(section.Title)
+		start, end := sentences[section.Start].start, sentences[section.End].end
+		body := text[start:end]
+		// Drop titles that leave no room for the body
+		if charCount(title)+1 >= c.chunkSize/2 {
+			title = ""
+		}
+		if title == "" {
+			if charCount(body) <= c.chunkSize {
+				chunks = append(chunks, newChunk(text, start, end, SeparatorLevelSection))
+			} else {
+				chunks = append(chunks, shiftChunks((&Chunking{chunkSize: c.chunkSize}).RecursiveChunking(body), start)...)
+			}
+			continue
+		}
+		if charCount(title)+1+charCount(body) <= c.chunkSize {
+			chunk := newChunk(text, start, end, SeparatorLevelSection)
+			chunk.Text = title + "\n" + chunk.Text
+			chunks = append(chunks, chunk)
+			continue
+		}
+		splitter := &Chunking{chunkSize: c.chunkSize - charCount(title) - 1}
+		for _, part := range shiftChunks(splitter.RecursiveChunking(body), start) {
+			part.Text = title + "\n" + part.Text
+			chunks = append(chunks, part)
+		}
+	}
+	return indexChunks(chunks), nil
+}
+
+// parseAgenticSections decodes the sections proposed by the LLM and checks that they
+// cover sentences 0..count-1 contiguously and in order
+func parseAgenticSections(content string, count int) ([]agenticSection, error) {
+	// Models sometimes wrap the JSON in a markdown code block or add text around it
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in llm output")
+	}
+	var out struct {
+		Sections []agenticSection `json:"sections"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &out); err != nil {
+		return nil, fmt.Errorf("failed to decode sections: %w", err)
+	}
+	if len(out.Sections) == 0 {
+		return nil, errors.New("no sections proposed")
+	}
+	next := 0
+	for i, section := range out.Sections {
+		if section.Start != next {
+			return nil, fmt.Errorf("section %d starts at %d, expected %d", i, section.Start, next)
+		}
+		if section.End < section.Start || section.End >= count {
+			return nil, fmt.Errorf("section %d has invalid end %d", i, section.End)
+		}
+		next = section.End + 1
+	}
+	if next != count {
+		return nil, fmt.Errorf("sections cover %d of %d sentences", next, count)
+	}
+	return out.Sections, nil
+}
+
+// textSpan is the byte range [start, end) of a piece of the text being chunked
+type textSpan struct {
+	start, end int
+}
+
+func spanTexts(text string, spans []textSpan) []string {
+	texts := make([]string, 0, len(spans))
+	for _, s := range spans {
+		texts = append(texts, text[s.start:s.end])
+	}
+	return texts
 }
 
-func (c *Chunking) SemanticChunking(text string) {
-	// Implement the logic for SemanticChunking
+// trimSpan shrinks span to exclude leading and trailing white space
+func trimSpan(text string, span textSpan) textSpan {
+	for span.start < span.end {
+		r, size := utf8.DecodeRuneInString(text[span.start:span.end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		span.start += size
+	}
+	for span.end > span.start {
+		r, size := utf8.DecodeLastRuneInString(text[span.start:span.end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		span.end -= size
+	}
+	return span
+}
+
+// splitSpans splits text[span] at every separator, dropping empty pieces
+func splitSpans(text string, span textSpan, sep string) []textSpan {
+	var spans []textSpan
+	start := span.start
+	for start <= span.end {
+		i := strings.Index(text[start:span.end], sep)
+		end := span.end
+		if i >= 0 {
+			end = start + i
+		}
+		if end > start {
+			spans = append(spans, textSpan{start, end})
+		}
+		if i < 0 {
+			break
+		}
+		start = end + len(sep)
+	}
+	return spans
+}
+
+// periodSpans splits text[span] after every period, keeping the period with its sentence
+func periodSpans(text string, span textSpan) []textSpan {
+	var spans []textSpan
+	start := span.start
+	for start < span.end {
+		end := span.end
+		if i := strings.IndexByte(text[start:span.end], '.'); i >= 0 {
+			end = start + i + 1
+		}
+		// A lone period between two periods carries no sentence
+		if text[start:end] != "." {
+			spans = append(spans, textSpan{start, end})
+		}
+		start = end
+	}
+	return spans
+}
+
+// wordSpans returns the spans of the white space separated words of text
+func wordSpans(text string) []textSpan {
+	var spans []textSpan
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, textSpan{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, textSpan{start, len(text)})
+	}
+	return spans
+}
+
+// sentenceSpans splits text at sentence terminators followed by white space and at line breaks.
+// Spans are trimmed of surrounding white space.
+func sentenceSpans(text string) []textSpan {
+	var spans []textSpan
+	start := 0
+	appendSentence := func(end int) {
+		if s := trimSpan(text, textSpan{start, end}); s.start < s.end {
+			spans = append(spans, s)
+		}
+		start = end
+	}
+	for i, r := range text {
+		end := i + utf8.RuneLen(r)
+		switch {
+		case r == '\n':
+			appendSentence(end)
+		case strings.ContainsRune(".!?…", r):
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			if end == len(text) || unicode.IsSpace(next) {
+				appendSentence(end)
+			}
+		}
+	}
+	appendSentence(len(text))
+	return spans
+}
+
+// percentile returns the p-th percentile (0-100) of values using linear interpolation
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(rank)
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// toValidUTF8 replaces invalid UTF-8 sequences so every chunk cut from the text is valid UTF-8
+func toValidUTF8(text string) string {
+	return strings.ToValidUTF8(text, string(utf8.RuneError))
+}
+
+// zeroWidthJoiner glues emoji sequences into a single character
+const zeroWidthJoiner = '\u200d'
+
+// isGraphemeBoundary reports whether a character starts at byte offset i of s. It is a
+// simplified form of the Unicode rules: combining marks, variation selectors and zero width
+// joiners stay with the preceding character, as does the LF of a CRLF pair.
+func isGraphemeBoundary(s string, i int) bool {
+	if i <= 0 || i >= len(s) {
+		return true
+	}
+	if !utf8.RuneStart(s[i]) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	prev, _ := utf8.DecodeLastRuneInString(s[:i])
+	switch {
+	case prev == '\r' && r == '\n':
+		return false
+	case prev == zeroWidthJoiner || r == zeroWidthJoiner:
+		return false
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector):
+		return false
+	}
+	return true
+}
+
+// graphemeOffsets returns the byte offsets at which the characters of s start, followed by len(s)
+func graphemeOffsets(s string) []int {
+	offsets := make([]int, 0, len(s)+1)
+	for i := range s {
+		if isGraphemeBoundary(s, i) {
+			offsets = append(offsets, i)
+		}
+	}
+	return append(offsets, len(s))
 }
 
-func (c *Chunking) AgenticChunking(text string) {
-	// Implement the logic for AgenticChunking
+// charCount returns the number of characters (grapheme clusters) of s
+func charCount(s string) int {
+	return len(graphemeOffsets(s)) - 1
 }
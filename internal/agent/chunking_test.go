@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"stockmind/internal/mockllm"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// chunkingTexts mix Vietnamese diacritics, emoji sequences, combining marks, invalid UTF-8,
+// Markdown and HTML
+var chunkingTexts = []struct {
+	name string
+	text string
+}{
+	{
+		name: "vietnamese",
+		text: "Thị trường chứng khoán Việt Nam tăng mạnh. Cổ phiếu ngân hàng dẫn dắt đà tăng!\n\n" +
+			"Nhà đầu tư nước ngoài bán ròng 1.234 tỷ đồng… Thanh khoản giảm?\nChỉ số VN-Index đóng cửa ở 1.250 điểm.",
+	},
+	{
+		name: "emoji and combining marks",
+		text: "Lãi ròng 👍🏽 tăng 👨‍👩‍👧 mạnh 🇻🇳. Café và phở rất ngon.\r\nDòng mới ✌️ ở đây.",
+	},
+	{
+		name: "invalid utf-8",
+		text: "Giá \xff\xfe cổ phiếu \xc3 tăng.\n\nDoanh thu \xe1\xba đạt 100 tỷ.",
+	},
+	{
+		name: "markdown",
+		text: "# Báo cáo thường niên\n\nDoanh thu năm 2024 tăng trưởng 12%.\n\n## Bảng cân đối\n\n" +
+			"| Chỉ tiêu | 2023 | 2024 |\n| --- | ---: | ---: |\n| Tài sản | 1.000 | 1.200 |\n| Nợ phải trả | 400 | 450 |\n\n" +
+			"- Tiền mặt tăng\n  nhờ thu hồi công nợ\n- Hàng tồn kho giảm\n\n```\nkhông tách khối mã\n```\n",
+	},
+	{
+		name: "html",
+		text: "<h1>Kết quả kinh doanh</h1>\n<p>Lợi nhuận quý 3 đạt kỷ lục.</p>\n<h2>Chi tiết</h2>\n" +
+			"<table>\n<tr><th>Quý</th><th>Lợi nhuận</th></tr>\n<tr><td>Q1</td><td>10</td></tr>\n" +
+			"<tr><td>Q2</td><td>12</td></tr>\n<tr><td>Q3</td><td>15</td></tr>\n</table>\n",
+	},
+	{
+		name: "empty",
+		text: "",
+	},
+}
+
+// agenticSectionsResponse answers AgenticChunking with one titled section per two sentences of text
+func agenticSectionsResponse(text string) mockllm.Response {
+	count := len(sentenceSpans(toValidUTF8(text)))
+	var sections []agenticSection
+	for start := 0; start < count; start += 2 {
+		sections = append(sections, agenticSection{Title: "Mục", Start: start, End: min(start+1, count-1)})
+	}
+	body, _ := json.Marshal(map[string]any{"sections": sections})
+	return mockllm.Response{Text: string(body)}
+}
+
+func TestChunkingStrategies(t *testing.T) {
+	tokenizer := newTestBPETokenizer(t)
+	llm := mockllm.NewServer()
+	defer llm.Close()
+	llmConfig := openai.DefaultConfig("test")
+	llmConfig.BaseURL = llm.URL
+	llmClient := &LLMClientWrapper{OfOpenAI: openai.NewClientWithConfig(llmConfig)}
+
+	characters := func(chunk Chunk) int { return charCount(chunk.Text) }
+	tests := []struct {
+		strategy ChunkingStrategy
+		overlap  int
+		// size measures a chunk in the unit of chunkSize
+		size func(chunk Chunk) int
+		// prefixed strategies may add a heading or title before the source text
+		prefixed bool
+	}{
+		{strategy: ChunkingStrategyFixedSize, size: characters},
+		{strategy: ChunkingStrategyFixedSize, overlap: 2, size: characters},
+		{strategy: ChunkingStrategyFixedSizeByWord, size: func(chunk Chunk) int { return len(wordSpans(chunk.Text)) }},
+		{strategy: ChunkingStrategyFixedSizeByWord, overlap: 2, size: func(chunk Chunk) int { return len(wordSpans(chunk.Text)) }},
+		{strategy: ChunkingStrategyFixedSizeWithTokenization, size: func(chunk Chunk) int { return tokenizer.Count(chunk.Text) }},
+		{strategy: ChunkingStrategyRecursive, size: characters},
+		{strategy: ChunkingStrategyRecursiveWithTokenization, size: func(chunk Chunk) int { return tokenizer.Count(chunk.Text) }},
+		{strategy: ChunkingStrategySemantic, size: characters},
+		{strategy: ChunkingStrategyAgentic, size: characters, prefixed: true},
+		{strategy: ChunkingStrategyStructural, size: characters, prefixed: true},
+	}
+	for _, tt := range tests {
+		for _, chunkSize := range []int{4, 16, 60} {
+			for _, input := range chunkingTexts {
+				name := fmt.Sprintf("%s/overlap %d/size %d/%s", tt.strategy, tt.overlap, chunkSize, input.name)
+				t.Run(name, func(t *testing.T) {
+					c, err := NewChunking(chunkSize, tt.overlap)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := c.SetTokenizer(tokenizer); err != nil {
+						t.Fatal(err)
+					}
+					if err := c.SetEmbedder(NewHashEmbedder(64), DefaultBreakpointPercentile); err != nil {
+						t.Fatal(err)
+					}
+					if err := c.SetLLM(llmClient, "test-model"); err != nil {
+						t.Fatal(err)
+					}
+					if tt.strategy == ChunkingStrategyAgentic && len(sentenceSpans(toValidUTF8(input.text))) > 0 {
+						llm.Enqueue(agenticSectionsResponse(input.text))
+					}
+
+					chunks, err := c.Split(context.Background(), tt.strategy, input.text)
+					if err != nil {
+						t.Fatalf("Split() returned %v", err)
+					}
+					if strings.TrimSpace(input.text) != "" && len(chunks) == 0 {
+						t.Fatalf("Split() returned no chunks")
+					}
+					source := toValidUTF8(input.text)
+					for i, chunk := range chunks {
+						if !utf8.ValidString(chunk.Text) {
+							t.Errorf("chunk %d is not valid UTF-8: %q", i, chunk.Text)
+						}
+						if chunk.Index != i {
+							t.Errorf("chunk %d has index %d", i, chunk.Index)
+						}
+						if chunk.Start < 0 || chunk.Start > chunk.End || chunk.End > len(source) {
+							t.Fatalf("chunk %d has offsets [%d, %d) outside the %d bytes of the text", i, chunk.Start, chunk.End, len(source))
+						}
+						if !isGraphemeBoundary(source, chunk.Start) || !isGraphemeBoundary(source, chunk.End) {
+							t.Errorf("chunk %d [%d, %d) cuts a character", i, chunk.Start, chunk.End)
+						}
+						span := source[chunk.Start:chunk.End]
+						text := chunk.Text
+						if chunk.Level == SeparatorLevelTable {
+							// Pieces of HTML tables are wrapped in their own table element
+							text = strings.TrimSuffix(text, "\n</table>")
+						}
+						switch {
+						case !tt.prefixed && text != span:
+							t.Errorf("chunk %d text %q, want text[%d:%d] = %q", i, chunk.Text, chunk.Start, chunk.End, span)
+						case tt.prefixed && !strings.HasSuffix(text, span):
+							t.Errorf("chunk %d text %q does not end with text[%d:%d] = %q", i, chunk.Text, chunk.Start, chunk.End, span)
+						}
+						if chunk.Level == "" {
+							t.Errorf("chunk %d has no level", i)
+						}
+						// Characters and table rows are never split, so a chunk holding a single character
+						// larger than chunkSize tokens or a table piece may exceed it, see TestStructuralChunking
+						oversized := charCount(span) == 1 || chunk.Level == SeparatorLevelTable
+						if size := tt.size(chunk); size > chunkSize && !oversized {
+							t.Errorf("chunk %d has size %d, want at most %d: %q", i, size, chunkSize, chunk.Text)
+						}
+					}
+				})
+			}
+		}
+	}
+	if llm.Pending() != 0 {
+		t.Errorf("%d scripted sections were not requested", llm.Pending())
+	}
+}
+
+func TestStructuralChunking(t *testing.T) {
+	type structuralChunk struct {
+		text  string
+		level SeparatorLevel
+	}
+	tests := []struct {
+		name      string
+		text      string
+		chunkSize int
+		want      []structuralChunk
+	}{
+		{
+			name:      "chunks never cross a heading and carry the heading path",
+			text:      "# Báo cáo\nDoanh thu tăng.\n## Bảng cân đối\nTài sản tăng.\n# Triển vọng\nỔn định.",
+			chunkSize: 100,
+			want: []structuralChunk{
+				{"Báo cáo\nDoanh thu tăng.", SeparatorLevelSection},
+				{"Báo cáo > Bảng cân đối\nTài sản tăng.", SeparatorLevelSection},
+				{"Triển vọng\nỔn định.", SeparatorLevelSection},
+			},
+		},
+		{
+			name:      "setext and html headings",
+			text:      "Báo cáo\n=======\n<p>Mở đầu.</p>\n<h2>Chi <b>tiết</b></h2>\n<p>Nội dung.</p>",
+			chunkSize: 100,
+			want: []structuralChunk{
+				{"Báo cáo\n<p>Mở đầu.</p>", SeparatorLevelSection},
+				{"Báo cáo > Chi tiết\n<p>Nội dung.</p>", SeparatorLevelSection},
+			},
+		},
+		{
+			name:      "small blocks are packed together",
+			text:      "# Tóm tắt\nMột.\n\nHai.\n\n- Ba",
+			chunkSize: 100,
+			want:      []structuralChunk{{"Tóm tắt\nMột.\n\nHai.\n\n- Ba", SeparatorLevelSection}},
+		},
+		{
+			name:      "list items are kept whole",
+			text:      "- Tiền mặt tăng\n  nhờ thu hồi công nợ\n- Hàng tồn kho giảm\n  1. Nguyên liệu\n- Nợ vay giảm",
+			chunkSize: 50,
+			want: []structuralChunk{
+				{"- Tiền mặt tăng\n  nhờ thu hồi công nợ", SeparatorLevelSection},
+				{"- Hàng tồn kho giảm\n  1. Nguyên liệu\n- Nợ vay giảm", SeparatorLevelSection},
+			},
+		},
+		{
+			name:      "table that fits stays whole",
+			text:      "## Giá\n| Mã | Giá |\n| --- | --- |\n| VNM | 70 |\n| FPT | 95 |",
+			chunkSize: 100,
+			want:      []structuralChunk{{"Giá\n| Mã | Giá |\n| --- | --- |\n| VNM | 70 |\n| FPT | 95 |", SeparatorLevelSection}},
+		},
+		{
+			name:      "large table is split between rows repeating the header",
+			text:      "## Giá\n| Mã | Giá |\n| --- | --- |\n| VNM | 70 |\n| FPT | 95 |\n| HPG | 27 |",
+			chunkSize: 60,
+			want: []structuralChunk{
+				{"Giá\n| Mã | Giá |\n| --- | --- |\n| VNM | 70 |\n| FPT | 95 |", SeparatorLevelTable},
+				{"Giá\n| Mã | Giá |\n| --- | --- |\n| HPG | 27 |", SeparatorLevelTable},
+			},
+		},
+		{
+			name:      "row larger than the chunk is kept whole",
+			text:      "| Mã | Giá |\n| --- | --- |\n| VNM | 70 |\n| FPT | 95 |",
+			chunkSize: 20,
+			want: []structuralChunk{
+				{"| Mã | Giá |\n| --- | --- |\n| VNM | 70 |", SeparatorLevelTable},
+				{"| Mã | Giá |\n| --- | --- |\n| FPT | 95 |", SeparatorLevelTable},
+			},
+		},
+		{
+			name: "large html table is split between rows",
+			text: "<table>\n<tr><th>Mã</th></tr>\n<tr><td>VNM</td></tr>\n<tr><td>FPT</td></tr>\n</table>",
+			// The header row and one data row fit, two data rows do not
+			chunkSize: 60,
+			want: []structuralChunk{
+				{"<table>\n<tr><th>Mã</th></tr>\n<tr><td>VNM</td></tr>\n</table>", SeparatorLevelTable},
+				{"<table>\n<tr><th>Mã</th></tr>\n<tr><td>FPT</td></tr>\n</table>", SeparatorLevelTable},
+			},
+		},
+		{
+			name:      "long paragraph is split recursively under its heading",
+			text:      "# Rủi ro\nLãi suất tăng. Tỷ giá biến động. Nợ xấu tăng.",
+			chunkSize: 40,
+			want: []structuralChunk{
+				{"Rủi ro\nLãi suất tăng.", SeparatorLevelSentence},
+				{"Rủi ro\nTỷ giá biến động.", SeparatorLevelSentence},
+				{"Rủi ro\nNợ xấu tăng.", SeparatorLevelSentence},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewChunking(tt.chunkSize, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := c.StructuralChunking(tt.text)
+			var got []structuralChunk
+			for _, chunk := range chunks {
+				got = append(got, structuralChunk{chunk.Text, chunk.Level})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("StructuralChunking() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// shortEmbedder drops the last vector, as a misbehaving provider could
+type shortEmbedder struct {
+	*HashEmbedder
+}
+
+func (e shortEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := e.HashEmbedder.Embed(ctx, texts)
+	return vectors[:len(vectors)-1], err
+}
+
+func TestSemanticChunkingShortEmbedding(t *testing.T) {
+	c, err := NewChunking(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetEmbedder(shortEmbedder{NewHashEmbedder(64)}, DefaultBreakpointPercentile); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := c.SemanticChunking(context.Background(), "Một. Hai. Ba.")
+	if err == nil {
+		t.Errorf("SemanticChunking() = %v, want an error for the missing vector", chunks)
+	}
+}
@@ -28,6 +28,13 @@ type OpenAIConfig struct {
 	BaseURL  string `json:"baseURL" yaml:"baseURL"`
 }
 
+type EmbeddingConfig struct {
+	Provider   string       `json:"provider" yaml:"provider"` // "openai" or "hash"
+	OpenAI     OpenAIConfig `json:"openai" yaml:"openai"`
+	Model      string       `json:"model" yaml:"model"`
+	Dimensions int          `json:"dimensions" yaml:"dimensions"`
+}
+
 type AnthropicConfig struct {
 	AuthType string              `json:"authType" yaml:"authType"` // "api_key" or "aws"
 	APIKey   string              `json:"api_key,omitempty" yaml:"api_key,omitempty"`
@@ -49,8 +56,32 @@ var OpenAIProvider = OpenAIConfig{
 }
 
 var AnthropicProvider = AnthropicConfig{
-	AuthType: "api_key",
+	AuthType: getEnv("ANTHROPIC_AUTH_TYPE", "api_key"),
 	APIKey:   os.Getenv("ANTHROPIC_API_KEY"),
+	AWS: AWSCredentialConfig{
+		Type:            getEnv("ANTHROPIC_AWS_CREDENTIAL_TYPE", "default"),
+		Region:          os.Getenv("AWS_REGION"),
+		RoleARN:         os.Getenv("ANTHROPIC_AWS_ROLE_ARN"),
+		RoleSessionName: os.Getenv("ANTHROPIC_AWS_ROLE_SESSION_NAME"),
+	},
+}
+
+var EmbeddingProvider = EmbeddingConfig{
+	Provider: getEnv("EMBEDDING_PROVIDER", "openai"),
+	OpenAI: OpenAIConfig{
+		AuthType: "openai",
+		APIKey:   os.Getenv("EMBEDDING_API_KEY"),
+		BaseURL:  getEnv("EMBEDDING_BASE_URL", "https://api.openai.com/v1"),
+	},
+	Model:      getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+	Dimensions: 1536,
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
 
 // func LoadConfig(filePath string) (*Config, error) {
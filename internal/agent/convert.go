@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"stockmind/internal/database"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// A conversation holds messages of both providers once a fallback model of the other provider
+// answered. The functions below convert the history to the provider being called: text, images,
+// tool calls and tool results are kept, reasoning is dropped since it cannot be replayed.
+
+// openAIMessages returns the history as OpenAI messages
+func openAIMessages(messages []*database.MessageUnion) []openai.ChatCompletionMessage {
+	result := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, m := range messages {
+		switch {
+		case m.OfOpenAI != nil:
+			result = append(result, *m.OfOpenAI)
+		case m.OfAnthropic != nil:
+			result = append(result, anthropicToOpenAI(*m.OfAnthropic)...)
+		}
+	}
+	return result
+}
+
+func anthropicToOpenAI(message anthropic.MessageParam) []openai.ChatCompletionMessage {
+	if message.Role == anthropic.MessageParamRoleAssistant {
+		assistant := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+		var text []string
+		for _, block := range message.Content {
+			switch {
+			case block.OfText != nil:
+				text = append(text, block.OfText.Text)
+			case block.OfToolUse != nil:
+				arguments, err := json.Marshal(block.OfToolUse.Input)
+				if err != nil {
+					arguments = []byte("{}")
+				}
+				assistant.ToolCalls = append(assistant.ToolCalls, openai.ToolCall{
+					ID:       block.OfToolUse.ID,
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: block.OfToolUse.Name, Arguments: string(arguments)},
+				})
+			}
+		}
+		assistant.Content = strings.Join(text, "\n")
+		return []openai.ChatCompletionMessage{assistant}
+	}
+
+	// Tool results become tool messages, which must directly follow the assistant message
+	var result []openai.ChatCompletionMessage
+	user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser}
+	attachments := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Name: toolAttachmentsName}
+	for _, block := range message.Content {
+		switch {
+		case block.OfText != nil:
+			user.MultiContent = append(user.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: block.OfText.Text})
+		case block.OfImage != nil:
+			if part, ok := openAIImagePart(*block.OfImage); ok {
+				user.MultiContent = append(user.MultiContent, part)
+			}
+		case block.OfToolResult != nil:
+			toolResult := block.OfToolResult
+			tool := openai.ChatCompletionMessage{
+				Role:         openai.ChatMessageRoleTool,
+				ToolCallID:   toolResult.ToolUseID,
+				MultiContent: []openai.ChatMessagePart{},
+			}
+			if toolResult.IsError.Value {
+				tool.MultiContent = append(tool.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: "The tool call failed:"})
+			}
+			for _, content := range toolResult.Content {
+				switch {
+				case content.OfText != nil:
+					tool.MultiContent = append(tool.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: content.OfText.Text})
+				case content.OfImage != nil:
+					if part, ok := openAIImagePart(*content.OfImage); ok {
+						tool.MultiContent = append(tool.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: "[image attached in the next user message]"})
+						attachments.MultiContent = append(attachments.MultiContent, part)
+					}
+				case content.OfDocument != nil:
+					tool.MultiContent = append(tool.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: omittedContentText("document", "application/pdf")})
+				}
+			}
+			if len(tool.MultiContent) == 0 {
+				tool.MultiContent = append(tool.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: "The tool returned no content."})
+			}
+			result = append(result, tool)
+		}
+	}
+	if len(attachments.MultiContent) > 0 {
+		result = append(result, attachments)
+	}
+	if len(user.MultiContent) > 0 {
+		result = append(result, user)
+	}
+	return result
+}
+
+// openAIImagePart converts a base64 image block to a data URL image part
+func openAIImagePart(image anthropic.ImageBlockParam) (openai.ChatMessagePart, bool) {
+	source := image.Source.OfBase64
+	if source == nil {
+		if url := image.Source.OfURL; url != nil {
+			return openai.ChatMessagePart{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: url.URL}}, true
+		}
+		return openai.ChatMessagePart{}, false
+	}
+	return openai.ChatMessagePart{
+		Type:     openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{URL: fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data)},
+	}, true
+}
+
+// anthropicMessages returns the history as Anthropic messages. Consecutive messages of the same
+// role are merged, which keeps the tool results of a turn in one user message.
+func anthropicMessages(messages []*database.MessageUnion) []anthropic.MessageParam {
+	result := make([]anthropic.MessageParam, 0, len(messages))
+	add := func(message anthropic.MessageParam) {
+		if len(message.Content) == 0 {
+			return
+		}
+		if last := len(result) - 1; last >= 0 && result[last].Role == message.Role {
+			merged := result[last]
+			merged.Content = append(append([]anthropic.ContentBlockParamUnion{}, merged.Content...), message.Content...)
+			result[last] = merged
+			return
+		}
+		result = append(result, message)
+	}
+	for _, m := range messages {
+		switch {
+		case m.OfAnthropic != nil:
+			add(*m.OfAnthropic)
+		case m.OfOpenAI != nil:
+			add(openAIToAnthropic(*m.OfOpenAI))
+		}
+	}
+	return result
+}
+
+func openAIToAnthropic(message openai.ChatCompletionMessage) anthropic.MessageParam {
+	var blocks []anthropic.ContentBlockParamUnion
+	text := func(text string) {
+		if strings.TrimSpace(text) != "" {
+			blocks = append(blocks, anthropic.NewTextBlock(text))
+		}
+	}
+	text(message.Content)
+	for _, part := range message.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			text(part.Text)
+		case openai.ChatMessagePartTypeImageURL:
+			if part.ImageURL != nil {
+				blocks = append(blocks, anthropicImageBlock(part.ImageURL.URL))
+			}
+		}
+	}
+
+	switch message.Role {
+	case openai.ChatMessageRoleAssistant:
+		for _, call := range message.ToolCalls {
+			var input any = map[string]any{}
+			if strings.TrimSpace(call.Function.Arguments) != "" && json.Valid([]byte(call.Function.Arguments)) {
+				input = json.RawMessage(call.Function.Arguments)
+			}
+			blocks = append(blocks, anthropic.NewToolUseBlock(call.ID, input, call.Function.Name))
+		}
+		return anthropic.NewAssistantMessage(blocks...)
+	case openai.ChatMessageRoleTool:
+		toolResult := anthropic.ToolResultBlockParam{ToolUseID: message.ToolCallID}
+		for _, block := range blocks {
+			if block.OfText != nil {
+				toolResult.Content = append(toolResult.Content, anthropic.ToolResultBlockParamContentUnion{OfText: block.OfText})
+			}
+		}
+		return anthropic.NewUserMessage(anthropic.ContentBlockParamUnion{OfToolResult: &toolResult})
+	default:
+		return anthropic.NewUserMessage(blocks...)
+	}
+}
+
+// anthropicImageBlock converts an image URL, data URLs included, to an image block
+func anthropicImageBlock(url string) anthropic.ContentBlockParamUnion {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mediaType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return anthropic.NewImageBlockBase64(mediaType, data)
+		}
+	}
+	return anthropic.NewImageBlock(anthropic.URLImageSourceParam{URL: url})
+}
@@ -3,6 +3,8 @@ package agent
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/exec"
 	"stockmind/internal/database"
 
 	"github.com/joho/godotenv"
@@ -11,19 +13,6 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-// Model ID in OpenRouter support function calling and free (https://openrouter.ai/models)
-const (
-	NEMOTRON_NANO_9B_V2 = "nvidia/nemotron-nano-9b-v2:free"
-	GLM_4_5_AIR         = "z-ai/glm-4.5-air:free"
-	QWEN3_CODE          = "qwen/qwen3-coder:free"
-	QWEN3_4B            = "qwen/qwen3-4b:free"
-	QWEN3_235B          = "qwen/qwen3-235b-a22b:free"
-	KIMI_K2             = "moonshotai/kimi-k2:free"
-	MISTRAL_SMALL       = "mistralai/mistral-small-3.2-24b-instruct:free"
-	DEVTRAL_SMALL       = "mistralai/devstral-small-2505:free"
-	DEEPSEEK_V3         = "deepseek/deepseek-chat-v3-0324:free"
-)
-
 func init() {
 	_ = godotenv.Load()
 }
@@ -46,14 +35,19 @@ type Agent struct {
 	provider   *LLMClientWrapper
 	tools      []mcp.Tool
 	mcpClients map[string]*mcp_client.Client // Cache of MCP clients by mcp config
+	knowledge  *KnowledgeSearcher            // Knowledge base used for retrieval, may be nil
+	// Consecutive failed tool calls and the error of the last one
+	toolFailures  int
+	lastToolError string
 }
 
-func NewAgent(ctx context.Context, session database.Session, name string, config database.AgentConfig, provider *LLMClientWrapper) (*Agent, error) {
+func NewAgent(ctx context.Context, session database.Session, name string, config database.AgentConfig, provider *LLMClientWrapper, knowledge *KnowledgeSearcher, workDir string) (*Agent, error) {
 	a := &Agent{
 		name:       name,
 		session:    session,
 		config:     config,
 		provider:   provider,
+		knowledge:  knowledge,
 		tools:      []mcp.Tool{},
 		mcpClients: make(map[string]*mcp_client.Client),
 	}
@@ -64,7 +58,7 @@ func NewAgent(ctx context.Context, session database.Session, name string, config
 		if _, exists := a.mcpClients[mcpCfg.Name]; exists {
 			continue
 		}
-		mcpClient, err := createMCPClient(ctx, mcpCfg)
+		mcpClient, err := createMCPClient(ctx, mcpCfg, workDir)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create MCP client for %s: %w", mcpCfg.Name, err)
 		}
@@ -90,10 +84,15 @@ func NewAgent(ctx context.Context, session database.Session, name string, config
 		a.tools = append(a.tools, tools...)
 	}
 	fmt.Println("MCP tools initialized", "count", len(a.tools))
+	// The model sees the discovered and static tools the allow and deny lists let through
+	a.tools = exposedTools(a.tools, config.Tools, config.AllowedTools, config.DeniedTools)
+	fmt.Println("Tools exposed to the model", "agentName", name, "count", len(a.tools))
 	return a, nil
 }
 
-func createMCPClient(ctx context.Context, cfg database.MCPConfig) (*mcp_client.Client, error) {
+// createMCPClient connects to the MCP server of cfg, stdio servers are started in workDir
+// when it is set
+func createMCPClient(ctx context.Context, cfg database.MCPConfig, workDir string) (*mcp_client.Client, error) {
 	// Create transport first
 	var mcpTransport transport.Interface
 	var err error
@@ -105,7 +104,16 @@ func createMCPClient(ctx context.Context, cfg database.MCPConfig) (*mcp_client.C
 		for k, v := range cfg.Envs {
 			envs = append(envs, fmt.Sprintf("%s=%s", k, v))
 		}
-		mcpTransport = transport.NewStdio(*cfg.Command, envs, cfg.Args...)
+		options := []transport.StdioOption{}
+		if workDir != "" {
+			options = append(options, transport.WithCommandFunc(func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+				cmd := exec.CommandContext(ctx, command, args...)
+				cmd.Env = append(os.Environ(), env...)
+				cmd.Dir = workDir
+				return cmd, nil
+			}))
+		}
+		mcpTransport = transport.NewStdioWithOptions(*cfg.Command, envs, cfg.Args, options...)
 	case "streamablehttp":
 		// Create streamablehttp transport
 		if cfg.URL == nil {
@@ -138,25 +146,28 @@ func createMCPClient(ctx context.Context, cfg database.MCPConfig) (*mcp_client.C
 	return mcpClient, nil
 }
 
-func (a *Agent) Completion(ctx context.Context, messages []*database.MessageUnion, callback ChatCallBack) (database.MessageUnion, database.StopReason, error) {
-	fmt.Println("Agent Completion called", "sessionId", a.session.ID, "agent_name", a.name, "model_provider", a.config.Provider)
+// completion calls the agent model once, grounding the system prompt in the retrieved chunks
+func (a *Agent) completion(ctx context.Context, messages []*database.MessageUnion, retrieved []ScoredChunk, callback ChatCallBack) (database.MessageUnion, database.StopReason, error) {
+	fmt.Println("Agent Completion called", "sessionId", a.session.ID, "agent_name", a.name, "model_provider", a.config.Provider, "model", a.config.ModelID)
 	switch a.config.Provider {
 	case database.ModelProviderOpenAI:
-		return a.completionOpenAI(ctx, messages, callback)
-	// case database.ModelProviderAnthropic:
-	// 	return a.completionAnthropic(ctx, messages, callback)
+		return a.completionOpenAI(ctx, messages, retrieved, callback)
+	case database.ModelProviderAnthropic:
+		return a.completionAnthropic(ctx, messages, retrieved, callback)
 	default:
 		return database.MessageUnion{}, database.StopReasonUnknown, fmt.Errorf("unsupported model provider: %s", a.config.Provider)
 	}
 }
 
-func (a *Agent) ToolUse(ctx context.Context, message *database.MessageUnion) (database.MessageUnion, error) {
-	switch a.config.Provider {
-	case database.ModelProviderOpenAI:
+// ToolUse calls the tools requested by message and returns the messages holding their results,
+// in the format of the provider that answered, which is not the agent provider after a fallback
+func (a *Agent) ToolUse(ctx context.Context, message *database.MessageUnion) ([]database.MessageUnion, error) {
+	switch {
+	case message.OfOpenAI != nil:
 		return a.toolUseOpenAI(ctx, message)
-	// case database.ModelProviderAnthropic:
-	// 	return a.toolUseAnthropic(ctx, message)
+	case message.OfAnthropic != nil:
+		return a.toolUseAnthropic(ctx, message)
 	default:
-		return database.MessageUnion{}, fmt.Errorf("unsupported model provider: %s", a.config.Provider)
+		return nil, fmt.Errorf("message has no content for any supported model provider")
 	}
 }
@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embedder turns texts into vectors. Vectors produced by different models are not
+// comparable, so Model is stored alongside every embedding.
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder creates the embedder described by config
+func NewEmbedder(config EmbeddingConfig) (Embedder, error) {
+	switch config.Provider {
+	case "openai":
+		return NewOpenAIEmbedder(config.OpenAI, config.Model, config.Dimensions)
+	case "hash":
+		return NewHashEmbedder(config.Dimensions), nil
+	default:
+		return nil, fmt.Errorf("unsupported embedding provider: %s", config.Provider)
+	}
+}
+
+// openAIEmbeddingBatchSize is the number of inputs sent in one embeddings request
+const openAIEmbeddingBatchSize = 64
+
+// OpenAIEmbedder calls an OpenAI compatible /embeddings endpoint
+type OpenAIEmbedder struct {
+	client     *openai.Client
+	model      string
+	dimensions int
+}
+
+func NewOpenAIEmbedder(config OpenAIConfig, model string, dimensions int) (*OpenAIEmbedder, error) {
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("API key for embedding provider is not found")
+	}
+	wrapper, err := createOpenAIClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if wrapper.OfOpenAI == nil {
+		return nil, fmt.Errorf("unsupported auth type for embedding provider: %s", config.AuthType)
+	}
+	return &OpenAIEmbedder{
+		client:     wrapper.OfOpenAI,
+		model:      model,
+		dimensions: dimensions,
+	}, nil
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for start := 0; start < len(texts); start += openAIEmbeddingBatchSize {
+		end := min(start+openAIEmbeddingBatchSize, len(texts))
+		resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Input:      texts[start:end],
+			Model:      openai.EmbeddingModel(e.model),
+			Dimensions: e.dimensions,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embeddings: %w", err)
+		}
+		for _, data := range resp.Data {
+			if data.Index < 0 || start+data.Index >= end {
+				return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+			}
+			vectors[start+data.Index] = data.Embedding
+		}
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// HashEmbedder is a deterministic local embedder using feature hashing of the words
+// of a text. It needs no network access and is meant for tests and offline runs.
+type HashEmbedder struct {
+	dimensions int
+}
+
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = 256
+	}
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+func (e *HashEmbedder) Model() string {
+	return fmt.Sprintf("hash-%d", e.dimensions)
+}
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vector := make([]float32, e.dimensions)
+		for _, word := range embeddingWords(text) {
+			h := fnv.New64a()
+			h.Write([]byte(word))
+			sum := h.Sum64()
+			// Use the top bit as the sign so that collisions tend to cancel out
+			if sum>>63 == 1 {
+				vector[sum%uint64(e.dimensions)] -= 1
+			} else {
+				vector[sum%uint64(e.dimensions)] += 1
+			}
+		}
+		normalize(vector)
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
+// embeddingWords splits text into lower-cased words of letters and digits
+func embeddingWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// normalize scales vector to unit length in place
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"stockmind/internal/database"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 8 * time.Second
+)
+
+// defaultRetryableStatusCodes are the rate limit, overload and transient server errors
+var defaultRetryableStatusCodes = []int{408, 409, 429, 500, 502, 503, 504, 529}
+
+// retryPolicy is database.RetryPolicy with the defaults applied
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	statusCodes    []int
+}
+
+func newRetryPolicy(cfg *database.RetryPolicy) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:    defaultMaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		statusCodes:    defaultRetryableStatusCodes,
+	}
+	if cfg == nil {
+		return policy
+	}
+	if cfg.MaxAttempts > 0 {
+		policy.maxAttempts = int(cfg.MaxAttempts)
+	}
+	if cfg.InitialBackoff > 0 {
+		policy.initialBackoff = time.Duration(cfg.InitialBackoff) * time.Millisecond
+	}
+	if cfg.MaxBackoff > 0 {
+		policy.maxBackoff = time.Duration(cfg.MaxBackoff) * time.Millisecond
+	}
+	if len(cfg.RetryableStatusCodes) > 0 {
+		policy.statusCodes = cfg.RetryableStatusCodes
+	}
+	return policy
+}
+
+// backoff returns the delay before the next attempt: exponential in the number of failed
+// attempts, capped, with jitter over its upper half so concurrent sessions do not retry in step
+func (p retryPolicy) backoff(failures int) time.Duration {
+	delay := p.initialBackoff
+	for i := 1; i < failures && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.maxBackoff)
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// retryable reports whether err is a transient failure of the provider worth another attempt
+func (p retryPolicy) retryable(err error) bool {
+	if code := statusCode(err); code != 0 {
+		return slices.Contains(p.statusCodes, code)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// statusCode extracts the HTTP status code of a provider error, 0 when there is none. Errors
+// sent in the middle of a stream carry the code in the error body rather than the response.
+func statusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.HTTPStatusCode != 0 {
+			return apiErr.HTTPStatusCode
+		}
+		switch code := apiErr.Code.(type) {
+		case float64:
+			return int(code)
+		case string:
+			if n, err := strconv.Atoi(code); err == nil {
+				return n
+			}
+		}
+		return 0
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		// An error event of a stream is decoded with the status of the stream response, 200
+		if anthropicErr.StatusCode >= 400 {
+			return anthropicErr.StatusCode
+		}
+		return anthropicErrorTypeStatus(anthropicErr.Type())
+	}
+	return anthropicStreamErrorStatus(err)
+}
+
+// anthropicStreamErrorPrefix starts the error the Anthropic SDK returns for an error event
+// of a stream it could not decode into an anthropic.Error, followed by the event data
+const anthropicStreamErrorPrefix = "received error while streaming: "
+
+// anthropicStreamErrorStatus decodes the type of an Anthropic stream error event, such as
+// {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}, into the status
+// code the API returns for that type outside of a stream
+func anthropicStreamErrorStatus(err error) int {
+	for ; err != nil; err = errors.Unwrap(err) {
+		data, ok := strings.CutPrefix(err.Error(), anthropicStreamErrorPrefix)
+		if !ok {
+			continue
+		}
+		var event struct {
+			Error struct {
+				Type anthropic.ErrorType `json:"type"`
+			} `json:"error"`
+		}
+		if json.Unmarshal([]byte(data), &event) != nil {
+			return 0
+		}
+		return anthropicErrorTypeStatus(event.Error.Type)
+	}
+	return 0
+}
+
+// anthropicErrorTypeStatus maps the transient Anthropic error types to their status code
+func anthropicErrorTypeStatus(errorType anthropic.ErrorType) int {
+	switch errorType {
+	case anthropic.ErrorTypeOverloadedError:
+		return 529
+	case anthropic.ErrorTypeRateLimitError:
+		return 429
+	case anthropic.ErrorTypeTimeoutError:
+		return 504
+	case anthropic.ErrorTypeAPIError:
+		return 500
+	}
+	return 0
+}
+
+// candidates returns the agent model followed by its fallbacks
+func (a *Agent) candidates() []database.ModelFallback {
+	candidates := []database.ModelFallback{{Provider: a.config.Provider, ModelID: a.config.ModelID}}
+	for _, fallback := range a.config.Fallbacks {
+		if fallback.Provider == "" {
+			fallback.Provider = a.config.Provider
+		}
+		candidates = append(candidates, fallback)
+	}
+	return candidates
+}
+
+// withModel returns a copy of the agent completing with another model
+func (a *Agent) withModel(model database.ModelFallback) *Agent {
+	clone := *a
+	clone.config.Provider = model.Provider
+	clone.config.ModelID = model.ModelID
+	return &clone
+}
+
+// Completion calls the agent model, retrying transient failures with backoff and failing over
+// to the fallback models in order. It returns the ID of the model that answered. A failure
+// after part of the answer was streamed to the callback is not retried. The knowledge base is
+// searched once and every attempt is grounded in the same chunks.
+func (a *Agent) Completion(ctx context.Context, messages []*database.MessageUnion, callback ChatCallBack) (database.MessageUnion, database.StopReason, string, error) {
+	policy := newRetryPolicy(a.config.Retry)
+	retrieved := a.retrieve(ctx, messages)
+	var errs []error
+	for i, candidate := range a.candidates() {
+		model := a.withModel(candidate)
+		for attempt := 1; ; attempt++ {
+			streamed := false
+			var cb ChatCallBack
+			if callback != nil {
+				cb = func(textContent string, thinking bool, endBlock bool) error {
+					streamed = true
+					return callback(textContent, thinking, endBlock)
+				}
+			}
+			result, stopReason, err := model.completion(ctx, messages, retrieved, cb)
+			if err == nil {
+				if i > 0 {
+					fmt.Println("Answered by fallback model", "sessionId", a.session.ID, "agent_name", a.name, "model_provider", candidate.Provider, "model", candidate.ModelID)
+				}
+				return result, stopReason, candidate.ModelID, nil
+			}
+			if ctx.Err() != nil || streamed {
+				return result, stopReason, candidate.ModelID, err
+			}
+			errs = append(errs, fmt.Errorf("%s %s attempt %d: %w", candidate.Provider, candidate.ModelID, attempt, err))
+			if attempt >= policy.maxAttempts || !policy.retryable(err) {
+				fmt.Println("Model failed", "sessionId", a.session.ID, "agent_name", a.name, "model_provider", candidate.Provider, "model", candidate.ModelID, "attempts", attempt, "error", err)
+				break
+			}
+
+			delay := policy.backoff(attempt)
+			fmt.Println("Retrying completion", "sessionId", a.session.ID, "agent_name", a.name, "model", candidate.ModelID, "attempt", attempt, "delay", delay, "error", err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return database.MessageUnion{}, database.StopReasonNil, "", ctx.Err()
+			}
+		}
+	}
+	return database.MessageUnion{}, database.StopReasonNil, "", fmt.Errorf("every model of agent %s failed: %w", a.name, errors.Join(errs...))
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"fmt"
+
+	"stockmind/internal/database"
+)
+
+// Model ID in OpenRouter support function calling and free (https://openrouter.ai/models)
+const (
+	NEMOTRON_NANO_9B_V2 = "nvidia/nemotron-nano-9b-v2:free"
+	GLM_4_5_AIR         = "z-ai/glm-4.5-air:free"
+	QWEN3_CODE          = "qwen/qwen3-coder:free"
+	QWEN3_4B            = "qwen/qwen3-4b:free"
+	QWEN3_235B          = "qwen/qwen3-235b-a22b:free"
+	KIMI_K2             = "moonshotai/kimi-k2:free"
+	MISTRAL_SMALL       = "mistralai/mistral-small-3.2-24b-instruct:free"
+	DEVTRAL_SMALL       = "mistralai/devstral-small-2505:free"
+	DEEPSEEK_V3         = "deepseek/deepseek-chat-v3-0324:free"
+)
+
+// Model ID in OpenRouter without function calling, usable by agents without tools
+const (
+	GEMMA_3_27B = "google/gemma-3-27b-it:free"
+)
+
+// Model ID in the Anthropic API (https://docs.anthropic.com/en/docs/about-claude/models)
+const (
+	CLAUDE_SONNET_4_5 = "claude-sonnet-4-5"
+	CLAUDE_HAIKU_4_5  = "claude-haiku-4-5"
+	CLAUDE_OPUS_4_1   = "claude-opus-4-1"
+)
+
+// ModelInfo describes a model an agent can use. Prices are in USD per million tokens.
+type ModelInfo struct {
+	Alias    string                 `json:"alias"`
+	Provider database.ModelProvider `json:"provider"`
+	ID       string                 `json:"id"`
+	// BedrockID is the inference profile used when Anthropic authenticates with AWS
+	BedrockID     string  `json:"bedrockId,omitempty"`
+	ContextWindow int64   `json:"contextWindow"`
+	ToolCalling   bool    `json:"toolCalling"`
+	Free          bool    `json:"free"`
+	InputPrice    float64 `json:"inputPrice"`
+	OutputPrice   float64 `json:"outputPrice"`
+	// ExclusiveSampling models reject requests setting both temperature and top_p
+	ExclusiveSampling bool `json:"exclusiveSampling,omitempty"`
+}
+
+// modelRegistry maps the aliases agent flows may use as modelId to the provider models
+var modelRegistry = map[string]ModelInfo{
+	"NEMOTRON_NANO_9B_V2": {Provider: database.ModelProviderOpenAI, ID: NEMOTRON_NANO_9B_V2, ContextWindow: 128000, ToolCalling: true, Free: true},
+	"GLM_4_5_AIR":         {Provider: database.ModelProviderOpenAI, ID: GLM_4_5_AIR, ContextWindow: 131072, ToolCalling: true, Free: true},
+	"QWEN3_CODE":          {Provider: database.ModelProviderOpenAI, ID: QWEN3_CODE, ContextWindow: 262144, ToolCalling: true, Free: true},
+	"QWEN3_4B":            {Provider: database.ModelProviderOpenAI, ID: QWEN3_4B, ContextWindow: 40960, ToolCalling: true, Free: true},
+	"QWEN3_235B":          {Provider: database.ModelProviderOpenAI, ID: QWEN3_235B, ContextWindow: 131072, ToolCalling: true, Free: true},
+	"KIMI_K2":             {Provider: database.ModelProviderOpenAI, ID: KIMI_K2, ContextWindow: 32768, ToolCalling: true, Free: true},
+	"MISTRAL_SMALL":       {Provider: database.ModelProviderOpenAI, ID: MISTRAL_SMALL, ContextWindow: 131072, ToolCalling: true, Free: true},
+	"DEVTRAL_SMALL":       {Provider: database.ModelProviderOpenAI, ID: DEVTRAL_SMALL, ContextWindow: 32768, ToolCalling: true, Free: true},
+	"DEEPSEEK_V3":         {Provider: database.ModelProviderOpenAI, ID: DEEPSEEK_V3, ContextWindow: 163840, ToolCalling: true, Free: true},
+	"GEMMA_3_27B":         {Provider: database.ModelProviderOpenAI, ID: GEMMA_3_27B, ContextWindow: 96000, ToolCalling: false, Free: true},
+	"CLAUDE_SONNET_4_5": {
+		Provider:          database.ModelProviderAnthropic,
+		ID:                CLAUDE_SONNET_4_5,
+		BedrockID:         "us.anthropic.claude-sonnet-4-5-20250929-v1:0",
+		ContextWindow:     200000,
+		ToolCalling:       true,
+		InputPrice:        3,
+		OutputPrice:       15,
+		ExclusiveSampling: true,
+	},
+	"CLAUDE_HAIKU_4_5": {
+		Provider:          database.ModelProviderAnthropic,
+		ID:                CLAUDE_HAIKU_4_5,
+		BedrockID:         "us.anthropic.claude-haiku-4-5-20251001-v1:0",
+		ContextWindow:     200000,
+		ToolCalling:       true,
+		InputPrice:        1,
+		OutputPrice:       5,
+		ExclusiveSampling: true,
+	},
+	"CLAUDE_OPUS_4_1": {
+		Provider:          database.ModelProviderAnthropic,
+		ID:                CLAUDE_OPUS_4_1,
+		BedrockID:         "us.anthropic.claude-opus-4-1-20250805-v1:0",
+		ContextWindow:     200000,
+		ToolCalling:       true,
+		InputPrice:        15,
+		OutputPrice:       75,
+		ExclusiveSampling: true,
+	},
+}
+
+func init() {
+	for alias, info := range modelRegistry {
+		info.Alias = alias
+		modelRegistry[alias] = info
+	}
+}
+
+// ResolveModel finds a registered model of provider by alias, or by its provider or Bedrock ID
+func ResolveModel(provider database.ModelProvider, modelID string) (ModelInfo, error) {
+	if info, ok := modelRegistry[modelID]; ok {
+		if info.Provider != provider {
+			return ModelInfo{}, fmt.Errorf("model %s is served by provider %s, not %s", modelID, info.Provider, provider)
+		}
+		return info, nil
+	}
+	for _, info := range modelRegistry {
+		if info.Provider == provider && (info.ID == modelID || (info.BedrockID != "" && info.BedrockID == modelID)) {
+			return info, nil
+		}
+	}
+	return ModelInfo{}, fmt.Errorf("unknown model %s for provider %s", modelID, provider)
+}
+
+// RequestID returns the model ID to send to the provider configured by providers
+func (m ModelInfo) RequestID(providers LLMProviderConfig) string {
+	if m.Provider == database.ModelProviderAnthropic && providers.Anthropic.AuthType == "aws" && m.BedrockID != "" {
+		return m.BedrockID
+	}
+	return m.ID
+}
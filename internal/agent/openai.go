@@ -2,9 +2,11 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
 	"stockmind/internal/database"
@@ -17,7 +19,11 @@ func createOpenAIClient(config OpenAIConfig) (*LLMClientWrapper, error) {
 	var openaiClient *openai.Client
 
 	if config.AuthType == "openai" {
-		openaiClient = openai.NewClient(config.APIKey)
+		defaultConfig := openai.DefaultConfig(config.APIKey)
+		if config.BaseURL != "" {
+			defaultConfig.BaseURL = config.BaseURL
+		}
+		openaiClient = openai.NewClientWithConfig(defaultConfig)
 	}
 	if config.AuthType == "open_router" {
 		var defaultConfig openai.ClientConfig
@@ -27,35 +33,40 @@ func createOpenAIClient(config OpenAIConfig) (*LLMClientWrapper, error) {
 		}
 		defaultConfig = openai.DefaultConfig(key)
 		defaultConfig.BaseURL = config.BaseURL
+		// OpenRouter specific parameters are merged into the request body by the transport
+		defaultConfig.HTTPClient = &http.Client{Transport: &extraBodyTransport{base: http.DefaultTransport}}
 
 		openaiClient = openai.NewClientWithConfig(defaultConfig)
 	}
 	return &LLMClientWrapper{OfOpenAI: openaiClient}, nil
 }
 
-func (a *Agent) newOpenAIMessage() openai.ChatCompletionRequest {
+func (a *Agent) newOpenAIMessage(retrieved []ScoredChunk) openai.ChatCompletionRequest {
 	request := openai.ChatCompletionRequest{
-		Model:       a.config.ModelID,
-		MaxTokens:   int(a.config.MaxTokens),
-		Temperature: float32(a.config.Temperature),
-		Stream:      true,
+		Model:     a.config.ModelID,
+		MaxTokens: int(a.config.MaxTokens),
+		TopP:      float32(a.config.TopP),
+		Stream:    true,
+	}
+	if a.config.Temperature != nil {
+		request.Temperature = float32(*a.config.Temperature)
 	}
 
 	var tools []openai.Tool
-	for _, tool := range a.config.Tools {
+	for _, tool := range a.tools {
 		openAITool := openai.Tool{
 			Type: openai.ToolTypeFunction,
 			Function: &openai.FunctionDefinition{
 				Name:        tool.Name,
 				Description: tool.Description,
-				Parameters:  tool.InputSchema,
+				Parameters:  toolParameters(tool),
 			},
 		}
 		tools = append(tools, openAITool)
 	}
 	request.Tools = tools
 	request.Messages = []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: a.config.SystemPrompt},
+		{Role: openai.ChatMessageRoleSystem, Content: withRetrievedContext(a.config.SystemPrompt, retrieved)},
 	}
 	return request
 }
@@ -73,140 +84,315 @@ func openaiToDbStopReason(reason openai.FinishReason) database.StopReason {
 	}
 }
 
-func (a *Agent) completionOpenAI(ctx context.Context, messages []*database.MessageUnion, callback ChatCallBack) (database.MessageUnion, database.StopReason, error) {
-	// Prepare messages for OpenAI
-	body := a.newOpenAIMessage()
-	for _, m := range messages {
-		if am := m.OfOpenAI; am != nil {
-			body.Messages = append(body.Messages, *am)
-		}
-	}
-	result := database.MessageUnion{
-		OfOpenAI: &openai.ChatCompletionMessage{
-			Role:         openai.ChatMessageRoleAssistant,
-			MultiContent: []openai.ChatMessagePart{},
-			ToolCalls:    []openai.ToolCall{},
-		},
-	}
-	var stopReason database.StopReason
+func (a *Agent) completionOpenAI(ctx context.Context, messages []*database.MessageUnion, retrieved []ScoredChunk, callback ChatCallBack) (database.MessageUnion, database.StopReason, error) {
+	// Prepare messages for OpenAI, grounding the system prompt in the knowledge base
+	body := a.newOpenAIMessage(retrieved)
+	body.Messages = append(body.Messages, openAIMessages(messages)...)
+	result := database.MessageUnion{}
 	// Call OpenAI API
 	if a.provider == nil || a.provider.OfOpenAI == nil {
-		return result, stopReason, fmt.Errorf("openAI client is not initialized")
+		return result, database.StopReasonNil, fmt.Errorf("openAI client is not initialized")
 	}
-	stream, err := a.provider.OfOpenAI.CreateChatCompletionStream(ctx, body)
+	stream, err := a.provider.OfOpenAI.CreateChatCompletionStream(withExtraBody(ctx, a.openRouterExtraBody()), body)
 	if err != nil {
-		return result, stopReason, err
+		return result, database.StopReasonNil, err
 	}
-
 	defer stream.Close()
 
-	contentItem := openai.ChatCompletionMessage{}
-
-	// Handle the stream
+	// Handle the stream, accumulating the deltas into the complete assistant message
+	acc := &openAIStreamAccumulator{callback: callback}
 	for {
-		response, err := stream.Recv()
+		raw, err := stream.RecvRaw()
 		if errors.Is(err, io.EOF) {
-			fmt.Println("\nStream finished")
-			return result, stopReason, err
+			break
 		}
-
 		if err != nil {
 			fmt.Printf("\nStream error: %v\n", err)
-			return result, stopReason, err
-		}
-
-		for _, chunk := range response.Choices {
-			// Handle the chunk
-			delta := chunk.Delta
-			switch {
-			case delta.Content != "":
-				contentItem.MultiContent = append(contentItem.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: delta.Content})
-			case len(delta.ToolCalls) > 0:
-				contentItem.ToolCalls = delta.ToolCalls
-			default:
-				continue
+			return result, database.StopReasonNil, err
+		}
+		if err := acc.add(raw); err != nil {
+			return result, database.StopReasonNil, err
+		}
+	}
+	if err := acc.endBlock(); err != nil {
+		return result, database.StopReasonNil, err
+	}
+
+	message := acc.message()
+	stopReason := openaiToDbStopReason(acc.finishReason)
+	// Some providers behind OpenRouter finish with stop even when the message calls tools
+	if len(message.ToolCalls) > 0 && stopReason == database.StopReasonAgentDone {
+		stopReason = database.StopReasonToolCall
+	}
+	fmt.Println("Stream finished", "finish_reason", acc.finishReason, "tool_calls", len(message.ToolCalls))
+	result.OfOpenAI = &message
+	return result, stopReason, nil
+}
+
+// openAIStreamDelta holds the delta fields go-openai does not decode. OpenRouter streams the
+// reasoning of thinking models in reasoning rather than reasoning_content.
+type openAIStreamDelta struct {
+	Choices []struct {
+		Delta struct {
+			Reasoning string `json:"reasoning"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// openAIStreamAccumulator merges the chunks of a chat completion stream into one assistant
+// message and forwards the text and reasoning deltas to the callback as they arrive
+type openAIStreamAccumulator struct {
+	callback     ChatCallBack
+	content      strings.Builder
+	reasoning    strings.Builder
+	refusal      strings.Builder
+	toolCalls    []openai.ToolCall
+	toolIndexes  map[int]int // stream index to position in toolCalls
+	finishReason openai.FinishReason
+	// inBlock and thinking track the block being streamed to the callback
+	inBlock  bool
+	thinking bool
+}
+
+func (acc *openAIStreamAccumulator) add(raw []byte) error {
+	var chunk openai.ChatCompletionStreamResponse
+	if err := json.Unmarshal(raw, &chunk); err != nil {
+		return fmt.Errorf("failed to decode stream chunk: %w", err)
+	}
+	var extra openAIStreamDelta
+	if err := json.Unmarshal(raw, &extra); err != nil {
+		return fmt.Errorf("failed to decode stream chunk: %w", err)
+	}
+
+	for i, choice := range chunk.Choices {
+		// Only the first choice is requested
+		if choice.Index != 0 {
+			continue
+		}
+		delta := choice.Delta
+		reasoning := delta.ReasoningContent
+		if reasoning == "" && i < len(extra.Choices) {
+			reasoning = extra.Choices[i].Delta.Reasoning
+		}
+		if reasoning != "" {
+			acc.reasoning.WriteString(reasoning)
+			if err := acc.emit(reasoning, true); err != nil {
+				return err
+			}
+		}
+		if delta.Content != "" {
+			acc.content.WriteString(delta.Content)
+			if err := acc.emit(delta.Content, false); err != nil {
+				return err
 			}
 		}
-		return result, stopReason, nil
+		acc.refusal.WriteString(delta.Refusal)
+		for _, call := range delta.ToolCalls {
+			acc.addToolCall(call)
+		}
+		if choice.FinishReason != "" {
+			acc.finishReason = choice.FinishReason
+		}
 	}
+	return nil
 }
 
-func (a *Agent) toolUseOpenAI(ctx context.Context, message *database.MessageUnion) (database.MessageUnion, error) {
+// addToolCall merges a tool call delta. The first delta of a call carries its id and name,
+// the following ones carry fragments of the arguments with the same index.
+func (acc *openAIStreamAccumulator) addToolCall(call openai.ToolCall) {
+	if acc.toolIndexes == nil {
+		acc.toolIndexes = make(map[int]int)
+	}
+	pos := -1
+	if call.Index != nil {
+		if p, ok := acc.toolIndexes[*call.Index]; ok {
+			pos = p
+		}
+	} else if call.ID == "" && len(acc.toolCalls) > 0 {
+		// Providers omitting the index stream the fragments of one call after another
+		pos = len(acc.toolCalls) - 1
+	}
+
+	if pos < 0 {
+		if call.Index != nil {
+			acc.toolIndexes[*call.Index] = len(acc.toolCalls)
+		}
+		acc.toolCalls = append(acc.toolCalls, openai.ToolCall{
+			ID:   call.ID,
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		})
+		return
+	}
+
+	existing := &acc.toolCalls[pos]
+	if existing.ID == "" {
+		existing.ID = call.ID
+	}
+	if existing.Function.Name == "" {
+		existing.Function.Name = call.Function.Name
+	}
+	existing.Function.Arguments += call.Function.Arguments
+}
+
+// emit forwards a delta to the callback, ending the previous block when the stream switches
+// between reasoning and text
+func (acc *openAIStreamAccumulator) emit(text string, thinking bool) error {
+	if acc.callback == nil {
+		return nil
+	}
+	if acc.inBlock && acc.thinking != thinking {
+		if err := acc.endBlock(); err != nil {
+			return err
+		}
+	}
+	acc.inBlock = true
+	acc.thinking = thinking
+	return acc.callback(text, thinking, false)
+}
+
+func (acc *openAIStreamAccumulator) endBlock() error {
+	if acc.callback == nil || !acc.inBlock {
+		return nil
+	}
+	acc.inBlock = false
+	return acc.callback("", acc.thinking, true)
+}
+
+// message returns the complete assistant message
+func (acc *openAIStreamAccumulator) message() openai.ChatCompletionMessage {
+	message := openai.ChatCompletionMessage{
+		Role:             openai.ChatMessageRoleAssistant,
+		Content:          acc.content.String(),
+		Refusal:          acc.refusal.String(),
+		ReasoningContent: acc.reasoning.String(),
+		ToolCalls:        acc.toolCalls,
+	}
+	// Tool calls without arguments must still send a valid JSON object back to the API
+	for i := range message.ToolCalls {
+		if strings.TrimSpace(message.ToolCalls[i].Function.Arguments) == "" {
+			message.ToolCalls[i].Function.Arguments = "{}"
+		}
+	}
+	return message
+}
+
+// toolAttachmentsName names the user message carrying the images returned by the tool calls,
+// since OpenAI only accepts images in user messages
+const toolAttachmentsName = "tool_attachments"
+
+func (a *Agent) toolUseOpenAI(ctx context.Context, message *database.MessageUnion) ([]database.MessageUnion, error) {
 	lastMessage := message.OfOpenAI
-	result := database.MessageUnion{}
 	if lastMessage == nil {
-		return result, fmt.Errorf("last message is not an Anthropic message")
+		return nil, fmt.Errorf("last message is not an OpenAI message")
+	}
+	if len(lastMessage.ToolCalls) == 0 {
+		fmt.Println("No tool use blocks found in chat history", "sessionId", a.session.ID, "agentName", a.name)
+		return nil, fmt.Errorf("no tool use blocks found in chat history")
+	}
+	calls := make([]toolCall, 0, len(lastMessage.ToolCalls))
+	for _, toolUse := range lastMessage.ToolCalls {
+		// Arguments are a JSON object encoded as a string, pass them to MCP as is
+		arguments := strings.TrimSpace(toolUse.Function.Arguments)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		call := toolCall{
+			ID:        toolUse.ID,
+			Name:      toolUse.Function.Name,
+			Arguments: json.RawMessage(arguments),
+		}
+		if !json.Valid([]byte(arguments)) {
+			call.Err = fmt.Errorf("invalid arguments of tool %s, expected a JSON object: %s", toolUse.Function.Name, arguments)
+		}
+		calls = append(calls, call)
+	}
+	toolResponses, err := a.callTools(ctx, calls)
+	if err != nil {
+		return nil, err
 	}
-	// Find the tool use block
-	toolUseBlocks := []openai.ToolCall{}
 
-	for _, block := range lastMessage.ToolCalls {
-		toolUseBlocks = append(toolUseBlocks, block)
+	// One tool message per call, paired with the call by its ID
+	results := make([]database.MessageUnion, 0, len(calls)+1)
+	attachments := []openai.ChatMessagePart{}
+	for i, call := range calls {
+		toolResult, images := openAIToolMessage(call, toolResponses[i])
+		results = append(results, database.MessageUnion{OfOpenAI: &toolResult})
+		attachments = append(attachments, images...)
 	}
-	if len(toolUseBlocks) == 0 {
-		fmt.Println("No tool use blocks found in chat history", "sessionId", a.session.ID, "agentName", a.name)
-		return result, fmt.Errorf("no tool use blocks found in chat history")
+	if len(attachments) > 0 {
+		attachmentMessage := openai.ChatCompletionMessage{
+			Role: openai.ChatMessageRoleUser,
+			Name: toolAttachmentsName,
+			MultiContent: append([]openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "Images returned by the tool calls above."},
+			}, attachments...),
+		}
+		results = append(results, database.MessageUnion{OfOpenAI: &attachmentMessage})
 	}
-	toolUseMessage := openai.ChatCompletionMessage{
-		Role:         openai.ChatMessageRoleUser,
+	return results, nil
+}
+
+// openAIToolMessage converts the result of a tool call to a tool message. Tool messages only hold
+// text, so images are returned separately, labelled with the call they come from.
+func openAIToolMessage(call toolCall, toolResponse *mcp.CallToolResult) (openai.ChatCompletionMessage, []openai.ChatMessagePart) {
+	toolResult := openai.ChatCompletionMessage{
+		Role:         openai.ChatMessageRoleTool,
+		ToolCallID:   call.ID,
+		Name:         call.Name,
 		MultiContent: []openai.ChatMessagePart{},
 	}
-	for _, toolUse := range toolUseBlocks {
-		fmt.Println("Invoking tool", "name", toolUse.Function.Name, "input", toolUse.Function.Arguments)
-		// Normally toolUse.Name will have format <mcp>/<tool_name>
-		parts := strings.SplitN(toolUse.Function.Name, "--", 2)
-		if len(parts) != 2 {
-			fmt.Println("Invalid tool name format, expected <mcp>--<tool_name>", "sessionId", a.session.ID, "agentName", a.name, "tool_name", toolUse.Function.Name)
-			return result, fmt.Errorf("invalid tool name format, expected <mcp>--<tool_name>")
-		}
-		mcpName := parts[0]
-		toolName := parts[1]
-		mcpClient, ok := a.mcpClients[mcpName]
-		if !ok {
-			fmt.Println("MCP client not found", "sessionId", a.session.ID, "agentName", a.name, "mcpName", mcpName)
-			return result, fmt.Errorf("MCP client not found: %s", mcpName)
-		}
-		// Serialize the input JSON into map[string] any
-		toolResponse, err := mcpClient.CallTool(ctx, mcp.CallToolRequest{
-			Params: mcp.CallToolParams{
-				Name:      toolName,
-				Arguments: toolUse.Function.Arguments,
-				Meta: &mcp.Meta{
-					AdditionalFields: map[string]any{
-						"user_id":    a.session.CreatedBy,
-						"session_id": a.session.ID,
-					},
-				},
-			},
-			// Header: http.Header{
-			// 	"X-Session-ID": []string{a.session.ID.String()},
-			// 	"X-User-ID":    []string{a.session.UserID.String()},
-			// },
-		})
-		if err != nil {
-			fmt.Println("Failed to call tool", "sessionId", a.session.ID, "agentName", a.name, "toolName", toolUse.Function.Name, "error", err)
-			return result, fmt.Errorf("failed to call tool %s: %w", toolUse.Function.Name, err)
-		}
-
-		toolResult := openai.ChatCompletionMessage{
-			Role:         openai.ChatMessageRoleTool,
-			ToolCallID:   toolUse.ID,
-			MultiContent: []openai.ChatMessagePart{},
-			Name:         toolUse.Function.Name,
-		}
-		// Convert the tool response content to anthropic format
-		for _, content := range toolResponse.Content {
-			switch content := content.(type) {
-			case mcp.TextContent:
-				toolResult.MultiContent = append(
-					toolResult.MultiContent,
-					openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: content.Text},
-				)
-				fmt.Println("Tool result: ", "sessionId", a.session.ID, "agentName", a.name, "tool_id", toolUse.ID, "tool_name", toolUse.Function.Name, "text", content.Text)
+	images := []openai.ChatMessagePart{}
+	imageCount := 0
+	text := func(text string) {
+		toolResult.MultiContent = append(toolResult.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: text})
+	}
+	image := func(data, mimeType string) {
+		imageCount++
+		text(fmt.Sprintf("[image %d of type %s is attached in the next user message]", imageCount, mimeType))
+		images = append(images,
+			openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: fmt.Sprintf("Image %d of tool call %s (%s):", imageCount, call.ID, call.Name)},
+			openai.ChatMessagePart{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: fmt.Sprintf("data:%s;base64,%s", mimeType, data)}},
+		)
+	}
+
+	for _, content := range toolResponse.Content {
+		switch content := content.(type) {
+		case mcp.TextContent:
+			text(content.Text)
+		case mcp.ImageContent:
+			image(content.Data, content.MIMEType)
+		case mcp.AudioContent:
+			text(omittedContentText("audio", content.MIMEType))
+		case mcp.ResourceLink:
+			text(resourceLinkText(content))
+		case mcp.EmbeddedResource:
+			switch resource := content.Resource.(type) {
+			case mcp.TextResourceContents:
+				text(resourceText(resource))
+			case mcp.BlobResourceContents:
+				if strings.HasPrefix(resource.MIMEType, "image/") {
+					image(resource.Blob, resource.MIMEType)
+				} else {
+					text(omittedContentText("resource "+resource.URI, resource.MIMEType))
+				}
 			}
 		}
-		toolUseMessage.MultiContent = append(toolUseMessage.MultiContent, toolResult.MultiContent...)
 	}
-	result.OfOpenAI = &toolUseMessage
-	return result, nil
+	if structured, ok := structuredContentText(toolResponse); ok {
+		text(structured)
+	}
+	if len(toolResult.MultiContent) == 0 {
+		text("The tool returned no content.")
+	}
+	// Tool messages have no error flag, the model learns about the failure from the text
+	if toolResponse.IsError {
+		toolResult.MultiContent = append([]openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "The tool call failed:"},
+		}, toolResult.MultiContent...)
+	}
+	return toolResult, images
 }
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type extraBodyKey struct{}
+
+// withExtraBody attaches fields the go-openai request types do not have, such as OpenRouter's
+// top_k and reasoning, to the requests made with ctx
+func withExtraBody(ctx context.Context, fields map[string]any) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, extraBodyKey{}, fields)
+}
+
+// extraBodyTransport merges the extra body fields of the request context into its JSON body
+type extraBodyTransport struct {
+	base http.RoundTripper
+}
+
+func (t *extraBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fields, ok := req.Context().Value(extraBodyKey{}).(map[string]any)
+	if !ok || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	for key, value := range fields {
+		body[key] = value
+	}
+	if data, err = json.Marshal(body); err != nil {
+		return nil, fmt.Errorf("failed to encode request body: %w", err)
+	}
+
+	// RoundTrip must not modify the original request
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return t.base.RoundTrip(req)
+}
+
+// openRouterExtraBody maps the sampling fields of the agent config the OpenAI API has no
+// parameter for. OpenRouter forwards top_k to the providers supporting it and translates the
+// reasoning budget for every thinking model.
+func (a *Agent) openRouterExtraBody() map[string]any {
+	fields := make(map[string]any)
+	if a.config.TopK > 0 {
+		fields["top_k"] = a.config.TopK
+	}
+	if a.config.ThinkingToken > 0 {
+		fields["reasoning"] = map[string]any{"max_tokens": a.config.ThinkingToken}
+	}
+	return fields
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// defaultRerankCandidates is the number of chunks retrieved for reranking when the config does not set candidates
+const defaultRerankCandidates = 20
+
+// Reranker rescores retrieved chunks against the query and keeps the topK best.
+// Scores of the returned chunks are reranker scores in [0, 1].
+type Reranker interface {
+	Rerank(ctx context.Context, query string, chunks []ScoredChunk, topK int) ([]ScoredChunk, error)
+}
+
+// LexicalReranker scores a chunk by the share of query words it contains. It needs no model
+// and is deterministic, which makes it the reranker for offline runs and tests.
+type LexicalReranker struct{}
+
+func NewLexicalReranker() *LexicalReranker {
+	return &LexicalReranker{}
+}
+
+func (r *LexicalReranker) Rerank(ctx context.Context, query string, chunks []ScoredChunk, topK int) ([]ScoredChunk, error) {
+	terms := make(map[string]bool)
+	for _, word := range embeddingWords(query) {
+		terms[word] = true
+	}
+	scores := make([]float64, len(chunks))
+	if len(terms) > 0 {
+		for i, chunk := range chunks {
+			found := make(map[string]bool)
+			for _, word := range embeddingWords(chunk.Content) {
+				if terms[word] {
+					found[word] = true
+				}
+			}
+			scores[i] = float64(len(found)) / float64(len(terms))
+		}
+	}
+	return rankByScores(chunks, scores, topK), nil
+}
+
+const llmRerankPrompt = `You judge how relevant passages are to a search query for a retrieval system.
+Score every passage from 0 (unrelated) to 10 (directly answers the query). Judge only the passage content, not its position.
+Answer with JSON only, in the form {"scores": [{"passage": 0, "score": 7}]}, with one entry per passage.`
+
+type llmRerankScore struct {
+	Passage int     `json:"passage"`
+	Score   float64 `json:"score"`
+}
+
+// LLMReranker asks a model of the OpenAI compatible client to judge every candidate in a single
+// request, a cheap stand-in for a cross-encoder
+type LLMReranker struct {
+	client *openai.Client
+	model  string
+}
+
+func NewLLMReranker(llm *LLMClientWrapper, model string) (*LLMReranker, error) {
+	if llm == nil || llm.OfOpenAI == nil {
+		return nil, errors.New("llm reranker requires an OpenAI compatible llm client")
+	}
+	if model == "" {
+		return nil, errors.New("llm reranker requires a model")
+	}
+	return &LLMReranker{
+		client: llm.OfOpenAI,
+		model:  model,
+	}, nil
+}
+
+func (r *LLMReranker) Rerank(ctx context.Context, query string, chunks []ScoredChunk, topK int) ([]ScoredChunk, error) {
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Query: %s\n", query)
+	for i, chunk := range chunks {
+		fmt.Fprintf(&sb, "\n[%d]\n%s\n", i, strings.TrimSpace(chunk.Content))
+	}
+	resp, err := r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: r.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: llmRerankPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: sb.String()},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request rerank scores from llm: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("llm returned no rerank scores")
+	}
+	scores, err := parseRerankScores(resp.Choices[0].Message.Content, len(chunks))
+	if err != nil {
+		return nil, err
+	}
+	return rankByScores(chunks, scores, topK), nil
+}
+
+// parseRerankScores decodes the judge output into one score in [0, 1] per passage.
+// Passages the model skipped score 0.
+func parseRerankScores(content string, count int) ([]float64, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in llm output")
+	}
+	var out struct {
+		Scores []llmRerankScore `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &out); err != nil {
+		return nil, fmt.Errorf("failed to decode rerank scores: %w", err)
+	}
+	if len(out.Scores) == 0 {
+		return nil, errors.New("no rerank scores returned")
+	}
+	scores := make([]float64, count)
+	for _, s := range out.Scores {
+		if s.Passage < 0 || s.Passage >= count {
+			continue
+		}
+		scores[s.Passage] = min(max(s.Score, 0), 10) / 10
+	}
+	return scores, nil
+}
+
+// rankByScores sorts chunks by scores, keeping the retrieval order on ties, and keeps the topK best
+func rankByScores(chunks []ScoredChunk, scores []float64, topK int) []ScoredChunk {
+	ranked := make([]ScoredChunk, len(chunks))
+	copy(ranked, chunks)
+	for i := range ranked {
+		ranked[i].Score = scores[i]
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	if topK > 0 && len(ranked) > topK {
+		ranked = ranked[:topK]
+	}
+	return ranked
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"stockmind/internal/mockllm"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// rerankResult describes reranked chunks by content and score
+type rerankResult struct {
+	content string
+	score   float64
+}
+
+func checkReranked(t *testing.T, got []ScoredChunk, want []rerankResult) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Rerank() returned %d chunks, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Content != w.content || math.Abs(got[i].Score-w.score) > 1e-12 {
+			t.Errorf("chunk %d = %q (%g), want %q (%g)", i, got[i].Content, got[i].Score, w.content, w.score)
+		}
+	}
+}
+
+func TestLexicalReranker(t *testing.T) {
+	chunks := rankedChunks(
+		"Giá vàng hôm nay",
+		"Lợi nhuận ngân hàng VCB tăng",
+		"Cổ phiếu VCB tăng mạnh, cổ phiếu ngân hàng dẫn dắt",
+		"VCB công bố cổ tức",
+	)
+	tests := []struct {
+		name  string
+		query string
+		topK  int
+		want  []rerankResult
+	}{
+		{
+			name:  "chunks are ordered by the share of query words they contain",
+			query: "cổ phiếu ngân hàng VCB",
+			topK:  4,
+			want: []rerankResult{
+				{"Cổ phiếu VCB tăng mạnh, cổ phiếu ngân hàng dẫn dắt", 1},
+				// Ties keep the retrieval order
+				{"Lợi nhuận ngân hàng VCB tăng", 0.6},
+				{"VCB công bố cổ tức", 0.4},
+				{"Giá vàng hôm nay", 0},
+			},
+		},
+		{
+			name:  "results are cut to topK",
+			query: "VCB tăng",
+			topK:  2,
+			want: []rerankResult{
+				{"Lợi nhuận ngân hàng VCB tăng", 1},
+				{"Cổ phiếu VCB tăng mạnh, cổ phiếu ngân hàng dẫn dắt", 1},
+			},
+		},
+		{
+			name:  "topK of zero keeps every chunk",
+			query: "vàng",
+			want: []rerankResult{
+				{"Giá vàng hôm nay", 1},
+				{"Lợi nhuận ngân hàng VCB tăng", 0},
+				{"Cổ phiếu VCB tăng mạnh, cổ phiếu ngân hàng dẫn dắt", 0},
+				{"VCB công bố cổ tức", 0},
+			},
+		},
+		{
+			name:  "query without words scores every chunk 0",
+			query: "?!",
+			topK:  1,
+			want:  []rerankResult{{"Giá vàng hôm nay", 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLexicalReranker().Rerank(context.Background(), tt.query, chunks, tt.topK)
+			if err != nil {
+				t.Fatalf("Rerank() returned %v", err)
+			}
+			checkReranked(t, got, tt.want)
+		})
+	}
+}
+
+func TestParseRerankScores(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []float64
+		wantErr bool
+	}{
+		{
+			name:    "every passage scored",
+			content: `{"scores": [{"passage": 0, "score": 7}, {"passage": 1, "score": 10}, {"passage": 2, "score": 0}]}`,
+			want:    []float64{0.7, 1, 0},
+		},
+		{
+			name:    "json wrapped in a code block",
+			content: "Here are the scores:\n```json\n{\"scores\": [{\"passage\": 1, \"score\": 5}]}\n```",
+			want:    []float64{0, 0.5, 0},
+		},
+		{
+			name:    "skipped passages score 0",
+			content: `{"scores": [{"passage": 2, "score": 8}]}`,
+			want:    []float64{0, 0, 0.8},
+		},
+		{
+			name:    "scores are clamped to 0-10",
+			content: `{"scores": [{"passage": 0, "score": 15}, {"passage": 1, "score": -3}, {"passage": 2, "score": 2.5}]}`,
+			want:    []float64{1, 0, 0.25},
+		},
+		{
+			name:    "unknown passages are ignored",
+			content: `{"scores": [{"passage": 3, "score": 9}, {"passage": -1, "score": 9}, {"passage": 0, "score": 4}]}`,
+			want:    []float64{0.4, 0, 0},
+		},
+		{
+			name:    "no JSON object",
+			content: "Passage 0 is the most relevant.",
+			wantErr: true,
+		},
+		{
+			name:    "truncated JSON",
+			content: `{"scores": [{"passage": 0, "score": 7}, {"passage": 1}`,
+			wantErr: true,
+		},
+		{
+			name:    "score that is not a number",
+			content: `{"scores": [{"passage": 0, "score": "high"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no scores",
+			content: `{"scores": []}`,
+			wantErr: true,
+		},
+		{
+			name:    "other object",
+			content: `{"ranking": [2, 0, 1]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRerankScores(tt.content, 3)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseRerankScores() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRerankScores() returned %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseRerankScores() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMRerankerRerank(t *testing.T) {
+	llm := mockllm.NewServer(
+		mockllm.Response{Text: `{"scores": [{"passage": 0, "score": 2}, {"passage": 1, "score": 9}, {"passage": 2, "score": 6}]}`},
+		mockllm.Response{Text: "I cannot score these passages."},
+	)
+	defer llm.Close()
+	config := openai.DefaultConfig("test")
+	config.BaseURL = llm.URL
+	reranker, err := NewLLMReranker(&LLMClientWrapper{OfOpenAI: openai.NewClientWithConfig(config)}, "judge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := rankedChunks("a", "b", "c")
+
+	got, err := reranker.Rerank(context.Background(), "query", chunks, 2)
+	if err != nil {
+		t.Fatalf("Rerank() returned %v", err)
+	}
+	checkReranked(t, got, []rerankResult{{"b", 0.9}, {"c", 0.6}})
+	request := llm.Requests()[0]
+	if request.Model != "judge" || !strings.Contains(request.Messages[1].Content, "[2]\nc") {
+		t.Errorf("judge request = %+v, want every passage numbered for model judge", request)
+	}
+
+	if _, err := reranker.Rerank(context.Background(), "query", chunks, 2); err == nil {
+		t.Error("Rerank() with a malformed judge answer returned no error")
+	}
+}
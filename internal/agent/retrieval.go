@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"stockmind/internal/database"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// defaultRetrievalTopK is used when the retrieval config does not set topK
+const defaultRetrievalTopK = 5
+
+// retrieve returns the chunks of the configured knowledge base relevant to the latest user message.
+// Retrieval failures are logged and the agent answers without context rather than failing the turn.
+func (a *Agent) retrieve(ctx context.Context, messages []*database.MessageUnion) []ScoredChunk {
+	if a.config.Retrieval == nil || a.knowledge == nil {
+		return nil
+	}
+	cfg := *a.config.Retrieval
+	if cfg.RerankModel == "" {
+		cfg.RerankModel = a.config.ModelID
+	}
+	query := latestUserText(messages)
+	if query == "" {
+		return nil
+	}
+	chunks, err := a.knowledge.WithLLM(a.provider).Search(ctx, cfg, query)
+	if err != nil {
+		fmt.Println("Failed to retrieve chunks", "sessionId", a.session.ID, "agentName", a.name, "knowledgeBase", cfg.KnowledgeBase, "error", err)
+		return nil
+	}
+	fmt.Println("Retrieved chunks", "sessionId", a.session.ID, "agentName", a.name, "knowledgeBase", cfg.KnowledgeBase, "mode", cfg.Mode, "reranker", cfg.Reranker, "count", len(chunks))
+	return chunks
+}
+
+// latestUserText returns the text of the last user message in the conversation. Anthropic
+// user messages holding only tool results and OpenAI tool attachments are skipped.
+func latestUserText(messages []*database.MessageUnion) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if am := messages[i].OfAnthropic; am != nil && am.Role == anthropic.MessageParamRoleUser {
+			var parts []string
+			for _, block := range am.Content {
+				if block.OfText != nil {
+					parts = append(parts, block.OfText.Text)
+				}
+			}
+			if len(parts) > 0 {
+				return strings.Join(parts, "\n")
+			}
+			continue
+		}
+		m := messages[i].OfOpenAI
+		if m == nil || m.Role != openai.ChatMessageRoleUser || m.Name == toolAttachmentsName {
+			continue
+		}
+		if m.Content != "" {
+			return m.Content
+		}
+		var parts []string
+		for _, part := range m.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				parts = append(parts, part.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// withRetrievedContext appends the retrieved chunks to the system prompt with citation markers
+func withRetrievedContext(systemPrompt string, chunks []ScoredChunk) string {
+	if len(chunks) == 0 {
+		return systemPrompt
+	}
+	var sb strings.Builder
+	sb.WriteString(systemPrompt)
+	sb.WriteString("\n\n")
+	sb.WriteString("Answer using the following excerpts from our knowledge base when they are relevant. ")
+	sb.WriteString("Cite every excerpt you rely on with its marker, e.g. [1], and do not invent citations. ")
+	sb.WriteString("If the excerpts do not contain the answer, say so before answering from general knowledge.\n")
+	for i, chunk := range chunks {
+		fmt.Fprintf(&sb, "\n[%d] %s, page %d\n%s\n", i+1, chunk.Source, chunk.PageNumber, strings.TrimSpace(chunk.Content))
+	}
+	return sb.String()
+}
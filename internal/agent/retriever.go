@@ -0,0 +1,285 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"stockmind/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// RetrievalQuery is a search for the chunks of one knowledge base
+type RetrievalQuery struct {
+	KnowledgeBaseID uuid.UUID
+	Text            string
+	TopK            int
+	// MinScore is the minimum cosine similarity of chunks found by vector search
+	MinScore float64
+}
+
+// Retriever finds the chunks of a knowledge base relevant to a query, best first
+type Retriever interface {
+	Retrieve(ctx context.Context, query RetrievalQuery) ([]ScoredChunk, error)
+}
+
+// Retrieve returns the chunks nearest to the query whose similarity reaches MinScore
+func (s *VectorStore) Retrieve(ctx context.Context, query RetrievalQuery) ([]ScoredChunk, error) {
+	chunks, err := s.Search(ctx, query.KnowledgeBaseID, query.Text, query.TopK)
+	if err != nil {
+		return nil, err
+	}
+	relevant := make([]ScoredChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if chunk.Score >= query.MinScore {
+			relevant = append(relevant, chunk)
+		}
+	}
+	return relevant, nil
+}
+
+// LexicalRetriever searches chunk contents with the Postgres full-text index. It finds exact
+// terms such as ticker symbols (HPG, VNM) that embeddings tend to miss.
+type LexicalRetriever struct {
+	queries *database.Queries
+}
+
+func NewLexicalRetriever(queries *database.Queries) *LexicalRetriever {
+	return &LexicalRetriever{queries: queries}
+}
+
+// Retrieve returns the chunks containing any word of the query, ranked by cover density.
+// Scores are normalized to [0, 1) but are not comparable with cosine similarities.
+func (r *LexicalRetriever) Retrieve(ctx context.Context, query RetrievalQuery) ([]ScoredChunk, error) {
+	tsquery := lexicalQuery(query.Text)
+	if tsquery == "" {
+		return nil, nil
+	}
+	rows, err := r.queries.SearchDocumentChunks(ctx, database.SearchDocumentChunksParams{
+		Query:           tsquery,
+		KnowledgeBaseID: query.KnowledgeBaseID,
+		TopK:            int32(query.TopK),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search document chunks: %w", err)
+	}
+	results := make([]ScoredChunk, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, ScoredChunk{
+			ChunkID:     row.ID,
+			DocumentID:  row.DocumentID,
+			Source:      row.Source,
+			Title:       row.Title,
+			PageNumber:  row.PageNumber,
+			StartOffset: row.StartOffset,
+			EndOffset:   row.EndOffset,
+			Content:     row.Content,
+			Score:       row.Score,
+		})
+	}
+	return results, nil
+}
+
+// lexicalQuery turns free text into a to_tsquery expression matching any of its words.
+// Words only hold letters and digits so they need no escaping.
+func lexicalQuery(text string) string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range embeddingWords(text) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return strings.Join(terms, " | ")
+}
+
+// DefaultRRFConstant is the k of reciprocal rank fusion, 60 as in the original paper
+const DefaultRRFConstant = 60
+
+// hybridCandidateFactor is how many more candidates than TopK each retriever contributes to the fusion
+const hybridCandidateFactor = 3
+
+// HybridRetriever runs several retrievers and merges their rankings with reciprocal rank fusion:
+// a chunk scores the sum of 1/(k+rank) over the lists it appears in. Scores are therefore
+// fusion scores, not similarities.
+type HybridRetriever struct {
+	retrievers []Retriever
+	k          float64
+}
+
+func NewHybridRetriever(retrievers ...Retriever) *HybridRetriever {
+	return &HybridRetriever{
+		retrievers: retrievers,
+		k:          DefaultRRFConstant,
+	}
+}
+
+// Retrieve fuses the results of every retriever. A failing retriever is logged and skipped,
+// the search only fails when all of them do.
+func (r *HybridRetriever) Retrieve(ctx context.Context, query RetrievalQuery) ([]ScoredChunk, error) {
+	candidates := query
+	candidates.TopK = query.TopK * hybridCandidateFactor
+
+	var rankings [][]ScoredChunk
+	var errs []error
+	for _, retriever := range r.retrievers {
+		chunks, err := retriever.Retrieve(ctx, candidates)
+		if err != nil {
+			fmt.Println("Retriever failed during hybrid search", "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		rankings = append(rankings, chunks)
+	}
+	if len(errs) == len(r.retrievers) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return fuseRankings(rankings, r.k, query.TopK), nil
+}
+
+// fuseRankings merges rankings with reciprocal rank fusion and keeps the topK best chunks. Chunks
+// with the same fused score keep the order in which they were first seen.
+func fuseRankings(rankings [][]ScoredChunk, k float64, topK int) []ScoredChunk {
+	fused := make(map[uuid.UUID]*ScoredChunk)
+	var order []uuid.UUID
+	for _, chunks := range rankings {
+		for rank, chunk := range chunks {
+			score := 1 / (k + float64(rank+1))
+			if existing, ok := fused[chunk.ChunkID]; ok {
+				existing.Score += score
+				continue
+			}
+			chunk.Score = score
+			fused[chunk.ChunkID] = &chunk
+			order = append(order, chunk.ChunkID)
+		}
+	}
+
+	results := make([]ScoredChunk, 0, len(order))
+	for _, id := range order {
+		results = append(results, *fused[id])
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// KnowledgeSearcher resolves knowledge bases by name and searches them with the retriever
+// selected by a retrieval config
+type KnowledgeSearcher struct {
+	queries *database.Queries
+	store   *VectorStore // nil when no embedder is configured, only lexical search is then available
+	lexical *LexicalRetriever
+	llm     *LLMClientWrapper // used by the llm reranker, may be nil
+}
+
+func NewKnowledgeSearcher(queries *database.Queries, store *VectorStore) *KnowledgeSearcher {
+	return &KnowledgeSearcher{
+		queries: queries,
+		store:   store,
+		lexical: NewLexicalRetriever(queries),
+	}
+}
+
+// WithLLM returns a copy of the searcher using llm for the llm reranker
+func (s *KnowledgeSearcher) WithLLM(llm *LLMClientWrapper) *KnowledgeSearcher {
+	return &KnowledgeSearcher{
+		queries: s.queries,
+		store:   s.store,
+		lexical: s.lexical,
+		llm:     llm,
+	}
+}
+
+// Retriever returns the retriever for mode. Without a vector store the hybrid mode
+// degrades to lexical search.
+func (s *KnowledgeSearcher) Retriever(mode database.RetrievalMode) (Retriever, error) {
+	switch mode {
+	case database.RetrievalModeVector:
+		if s.store == nil {
+			return nil, errors.New("vector search requires an embedder")
+		}
+		return s.store, nil
+	case database.RetrievalModeLexical:
+		return s.lexical, nil
+	case database.RetrievalModeHybrid, "":
+		if s.store == nil {
+			return s.lexical, nil
+		}
+		return NewHybridRetriever(s.store, s.lexical), nil
+	default:
+		return nil, fmt.Errorf("unsupported retrieval mode: %s", mode)
+	}
+}
+
+// Reranker returns the reranker selected by cfg, or nil when reranking is disabled
+func (s *KnowledgeSearcher) Reranker(cfg database.RetrievalConfig) (Reranker, error) {
+	switch cfg.Reranker {
+	case "":
+		return nil, nil
+	case database.RerankerLexical:
+		return NewLexicalReranker(), nil
+	case database.RerankerLLM:
+		return NewLLMReranker(s.llm, cfg.RerankModel)
+	default:
+		return nil, fmt.Errorf("unsupported reranker: %s", cfg.Reranker)
+	}
+}
+
+// Search returns the chunks of the knowledge base named in cfg relevant to query. With a reranker,
+// cfg.Candidates chunks are retrieved and the reranker keeps the topK best. A failing reranker
+// is logged and the topK first retrieved chunks are returned instead.
+func (s *KnowledgeSearcher) Search(ctx context.Context, cfg database.RetrievalConfig, query string) ([]ScoredChunk, error) {
+	kbName := cfg.KnowledgeBase
+	if kbName == "" {
+		kbName = database.DefaultKnowledgeBaseName
+	}
+	topK := int(cfg.TopK)
+	if topK <= 0 {
+		topK = defaultRetrievalTopK
+	}
+	retriever, err := s.Retriever(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+	reranker, err := s.Reranker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	candidates := topK
+	if reranker != nil {
+		candidates = int(cfg.Candidates)
+		if candidates <= 0 {
+			candidates = defaultRerankCandidates
+		}
+		candidates = max(candidates, topK)
+	}
+	kb, err := s.queries.GetKnowledgeBaseByName(ctx, kbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get knowledge base %s: %w", kbName, err)
+	}
+	chunks, err := retriever.Retrieve(ctx, RetrievalQuery{
+		KnowledgeBaseID: kb.ID,
+		Text:            query,
+		TopK:            candidates,
+		MinScore:        cfg.MinScore,
+	})
+	if err != nil || reranker == nil {
+		return chunks, err
+	}
+	reranked, err := reranker.Rerank(ctx, query, chunks, topK)
+	if err != nil {
+		fmt.Println("Failed to rerank chunks", "knowledgeBase", kbName, "reranker", cfg.Reranker, "error", err)
+		return chunks[:min(topK, len(chunks))], nil
+	}
+	return reranked, nil
+}
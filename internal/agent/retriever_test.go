@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// rankedChunks returns chunks whose IDs are derived from names, in the given order
+func rankedChunks(names ...string) []ScoredChunk {
+	chunks := make([]ScoredChunk, 0, len(names))
+	for _, name := range names {
+		chunks = append(chunks, ScoredChunk{
+			ChunkID: uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)),
+			Content: name,
+			Score:   0.5, // replaced by the fusion score
+		})
+	}
+	return chunks
+}
+
+func rrf(ranks ...int) float64 {
+	var score float64
+	for _, rank := range ranks {
+		score += 1 / float64(DefaultRRFConstant+rank)
+	}
+	return score
+}
+
+func TestFuseRankings(t *testing.T) {
+	type fused struct {
+		content string
+		score   float64
+	}
+	tests := []struct {
+		name     string
+		rankings [][]ScoredChunk
+		topK     int
+		want     []fused
+	}{
+		{
+			name:     "chunk in both lists ranks first",
+			rankings: [][]ScoredChunk{rankedChunks("a", "b"), rankedChunks("c", "b")},
+			topK:     5,
+			want:     []fused{{"b", rrf(2, 2)}, {"a", rrf(1)}, {"c", rrf(1)}},
+		},
+		{
+			name:     "chunks in only one list keep their rank score",
+			rankings: [][]ScoredChunk{rankedChunks("a", "b", "c"), nil},
+			topK:     5,
+			want:     []fused{{"a", rrf(1)}, {"b", rrf(2)}, {"c", rrf(3)}},
+		},
+		{
+			name:     "ties keep the order chunks were first seen",
+			rankings: [][]ScoredChunk{rankedChunks("a", "b"), rankedChunks("b", "a"), rankedChunks("c")},
+			topK:     5,
+			want:     []fused{{"a", rrf(1, 2)}, {"b", rrf(2, 1)}, {"c", rrf(1)}},
+		},
+		{
+			name:     "low ranks in two lists beat a top rank in one",
+			rankings: [][]ScoredChunk{rankedChunks("a", "x", "y", "z", "b"), rankedChunks("c", "d", "e", "f", "b")},
+			topK:     1,
+			want:     []fused{{"b", rrf(5, 5)}},
+		},
+		{
+			name:     "results are cut to topK",
+			rankings: [][]ScoredChunk{rankedChunks("a", "b", "c")},
+			topK:     2,
+			want:     []fused{{"a", rrf(1)}, {"b", rrf(2)}},
+		},
+		{
+			name:     "no rankings",
+			rankings: nil,
+			topK:     3,
+			want:     []fused{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fuseRankings(tt.rankings, DefaultRRFConstant, tt.topK)
+			if len(got) != len(tt.want) {
+				t.Fatalf("fuseRankings() returned %d chunks, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				if got[i].Content != want.content || math.Abs(got[i].Score-want.score) > 1e-12 {
+					t.Errorf("chunk %d = %s (%g), want %s (%g)", i, got[i].Content, got[i].Score, want.content, want.score)
+				}
+			}
+		})
+	}
+}
+
+// retrieverFunc adapts a function to the Retriever interface
+type retrieverFunc func(ctx context.Context, query RetrievalQuery) ([]ScoredChunk, error)
+
+func (f retrieverFunc) Retrieve(ctx context.Context, query RetrievalQuery) ([]ScoredChunk, error) {
+	return f(ctx, query)
+}
+
+func TestHybridRetrieverRetrieve(t *testing.T) {
+	failing := retrieverFunc(func(context.Context, RetrievalQuery) ([]ScoredChunk, error) {
+		return nil, errors.New("search failed")
+	})
+	var candidates int
+	lexical := retrieverFunc(func(_ context.Context, query RetrievalQuery) ([]ScoredChunk, error) {
+		candidates = query.TopK
+		return rankedChunks("a", "b"), nil
+	})
+
+	chunks, err := NewHybridRetriever(failing, lexical).Retrieve(context.Background(), RetrievalQuery{TopK: 1})
+	if err != nil {
+		t.Fatalf("Retrieve() with one failing retriever returned %v", err)
+	}
+	if candidates != hybridCandidateFactor {
+		t.Errorf("retrievers were asked for %d candidates, want %d", candidates, hybridCandidateFactor)
+	}
+	if len(chunks) != 1 || chunks[0].Content != "a" {
+		t.Errorf("Retrieve() = %+v, want chunk a", chunks)
+	}
+
+	if _, err := NewHybridRetriever(failing, failing).Retrieve(context.Background(), RetrievalQuery{TopK: 1}); err == nil {
+		t.Error("Retrieve() with every retriever failing returned no error")
+	}
+}
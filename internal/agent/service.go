@@ -6,38 +6,85 @@ import (
 	"log"
 	"stockmind/internal/database"
 
+	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	openai "github.com/sashabaranov/go-openai"
 )
 
 type LLMClientWrapper struct {
-	OfOpenAI *openai.Client
+	OfOpenAI    *openai.Client
+	OfAnthropic *anthropic.Client
 }
 
 type AgentService struct {
-	config  LLMProviderConfig
-	queries *database.Queries
-	ctx     context.Context
+	config    LLMProviderConfig
+	workDir   string
+	db        *pgxpool.Pool
+	queries   *database.Queries
+	knowledge *KnowledgeSearcher
+	ctx       context.Context
 }
 
-func NewService(ctx context.Context, dbPool *pgxpool.Pool, providers database.ModelProvider) (*AgentService, error) {
-	log.Println("Initializing LLM service...")
-	var config LLMProviderConfig
-	if providers == database.ModelProviderOpenAI {
-		config = LLMProviderConfig{OpenAI: OpenAIProvider}
-	}
-	if providers == database.ModelProviderAnthropic {
-		config = LLMProviderConfig{Anthropic: AnthropicProvider}
-	}
+// NewService creates the agent service. Every provider is configured because the agents of
+// a flow may use different providers
+func NewService(ctx context.Context, dbPool *pgxpool.Pool) (*AgentService, error) {
+	return NewServiceWithConfig(ctx, dbPool, ServiceConfig{
+		Providers: LLMProviderConfig{OpenAI: OpenAIProvider, Anthropic: AnthropicProvider},
+		Embedding: EmbeddingProvider,
+	})
+}
 
+// ServiceConfig configures the agent service
+type ServiceConfig struct {
+	Providers LLMProviderConfig
+	// Embedding is the provider embedding the knowledge base queries of the agents
+	Embedding EmbeddingConfig
+	// WorkDir is the working directory of stdio MCP servers, the current directory when empty
+	WorkDir string
+}
+
+// NewServiceWithConfig creates the agent service with the given configuration, such as a
+// local OpenAI compatible server in tests
+func NewServiceWithConfig(ctx context.Context, dbPool *pgxpool.Pool, config ServiceConfig) (*AgentService, error) {
+	log.Println("Initializing LLM service...")
+	queries := database.New(dbPool)
 	return &AgentService{
-		config:  config,
-		ctx:     ctx,
-		queries: database.New(dbPool),
+		config:    config.Providers,
+		workDir:   config.WorkDir,
+		ctx:       ctx,
+		db:        dbPool,
+		queries:   queries,
+		knowledge: newKnowledgeSearcher(queries, config.Embedding),
 	}, nil
 }
 
+// NewDefaultKnowledgeSearcher creates a knowledge searcher embedding queries with the default
+// embedding provider. Without a usable embedder only lexical search is available.
+func NewDefaultKnowledgeSearcher(queries *database.Queries) *KnowledgeSearcher {
+	return newKnowledgeSearcher(queries, EmbeddingProvider)
+}
+
+func newKnowledgeSearcher(queries *database.Queries, config EmbeddingConfig) *KnowledgeSearcher {
+	var store *VectorStore
+	embedder, err := NewEmbedder(config)
+	if err != nil {
+		log.Printf("Vector search is disabled, knowledge base retrieval falls back to lexical search: %v", err)
+	} else {
+		store = NewVectorStore(queries, embedder)
+	}
+	return NewKnowledgeSearcher(queries, store)
+}
+
+// NewLLMClient creates a client for provider using the default provider configuration
+func NewLLMClient(provider database.ModelProvider) (*LLMClientWrapper, error) {
+	s := &AgentService{
+		config: LLMProviderConfig{OpenAI: OpenAIProvider, Anthropic: AnthropicProvider},
+		ctx:    context.Background(),
+	}
+	return s.getClientByProvider(provider)
+}
+
 func (s *AgentService) getClientByProvider(provider database.ModelProvider) (*LLMClientWrapper, error) {
 	var client *LLMClientWrapper
 	var err error
@@ -48,7 +95,10 @@ func (s *AgentService) getClientByProvider(provider database.ModelProvider) (*LL
 			return nil, fmt.Errorf("failed to create OpenRouter client: %v", err)
 		}
 	case database.ModelProviderAnthropic:
-		return nil, fmt.Errorf("unsupported model provider: %s", string(provider))
+		client, err = createAnthropicClient(s.ctx, s.config.Anthropic)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Anthropic client: %v", err)
+		}
 	default:
 		log.Printf("Unsupported model provider: %s", string(provider))
 		return nil, fmt.Errorf("unsupported model provider: %s", string(provider))
@@ -56,6 +106,28 @@ func (s *AgentService) getClientByProvider(provider database.ModelProvider) (*LL
 	return client, nil
 }
 
+// getClientByProviders returns one client wrapper holding a client for each of the providers
+func (s *AgentService) getClientByProviders(providers []database.ModelProvider) (*LLMClientWrapper, error) {
+	clients := &LLMClientWrapper{}
+	for _, provider := range providers {
+		if (provider == database.ModelProviderOpenAI && clients.OfOpenAI != nil) ||
+			(provider == database.ModelProviderAnthropic && clients.OfAnthropic != nil) {
+			continue
+		}
+		client, err := s.getClientByProvider(provider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get LLM client for provider %s: %w", provider, err)
+		}
+		if client.OfOpenAI != nil {
+			clients.OfOpenAI = client.OfOpenAI
+		}
+		if client.OfAnthropic != nil {
+			clients.OfAnthropic = client.OfAnthropic
+		}
+	}
+	return clients, nil
+}
+
 func (s *AgentService) GetOrCreateSession(userID, agentFlowID, sessionID *uuid.UUID, sessionName *string) (*SessionManager, error) {
 	// Create a new session in the database
 	var session database.Session
@@ -6,6 +6,7 @@ import (
 
 	"stockmind/internal/database"
 
+	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/google/uuid"
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -33,6 +34,9 @@ func (sm *SessionManager) Initialize() error {
 		}
 		sm.history = msgs
 	}
+	if err := ValidateFlowConfig(sm.agentFlowCfg, sm.llm.config); err != nil {
+		return fmt.Errorf("invalid agent flow config: %w", err)
+	}
 	// Build node map for quick lookup
 	sm.nodes = make(map[string]database.Node, len(sm.agentFlowCfg.Nodes))
 	for _, node := range sm.agentFlowCfg.Nodes {
@@ -41,12 +45,42 @@ func (sm *SessionManager) Initialize() error {
 	// Initialize all agents
 	sm.agents = make(map[string]*Agent, len(sm.agentFlowCfg.Agents))
 	for name, agentCfg := range sm.agentFlowCfg.Agents {
+		// Flows may reference models by alias, requests need the provider model ID
+		model, err := ResolveModel(agentCfg.Provider, agentCfg.ModelID)
+		if err != nil {
+			return fmt.Errorf("failed to resolve model of agent %s: %w", name, err)
+		}
+		agentCfg.ModelID = model.RequestID(sm.llm.config)
+		if r := agentCfg.Retrieval; r != nil && r.RerankModel != "" {
+			rerankModel, err := ResolveModel(agentCfg.Provider, r.RerankModel)
+			if err != nil {
+				return fmt.Errorf("failed to resolve rerank model of agent %s: %w", name, err)
+			}
+			retrieval := *r
+			retrieval.RerankModel = rerankModel.RequestID(sm.llm.config)
+			agentCfg.Retrieval = &retrieval
+		}
+		fallbacks := make([]database.ModelFallback, 0, len(agentCfg.Fallbacks))
+		providers := []database.ModelProvider{agentCfg.Provider}
+		for _, fallback := range agentCfg.Fallbacks {
+			if fallback.Provider == "" {
+				fallback.Provider = agentCfg.Provider
+			}
+			model, err := ResolveModel(fallback.Provider, fallback.ModelID)
+			if err != nil {
+				return fmt.Errorf("failed to resolve fallback model of agent %s: %w", name, err)
+			}
+			fallback.ModelID = model.RequestID(sm.llm.config)
+			fallbacks = append(fallbacks, fallback)
+			providers = append(providers, fallback.Provider)
+		}
+		agentCfg.Fallbacks = fallbacks
 		// Get providers
-		provider, err := sm.llm.getClientByProvider(agentCfg.Provider)
+		provider, err := sm.llm.getClientByProviders(providers)
 		if err != nil {
-			return fmt.Errorf("failed to get LLM client for provider %s: %w", agentCfg.Provider, err)
+			return fmt.Errorf("failed to get LLM clients of agent %s: %w", name, err)
 		}
-		agent, err := NewAgent(sm.ctx, sm.session, name, agentCfg, provider)
+		agent, err := NewAgent(sm.ctx, sm.session, name, agentCfg, provider, sm.llm.knowledge, sm.llm.workDir)
 		if err != nil {
 			return fmt.Errorf("failed to initialize agent %s: %w", name, err)
 		}
@@ -150,6 +184,10 @@ func (sm *SessionManager) HumanInput(message string) error {
 		return err
 	}
 	sm.history = append(sm.history, history)
+	// Tool failures are counted within a turn
+	for _, agent := range sm.agents {
+		agent.toolFailures = 0
+	}
 	return nil
 }
 
@@ -213,15 +251,38 @@ func newHumanMessage(message string, provider database.ModelProvider) (database.
 				Content: message,
 			},
 		}, nil
-	// case database.ModelProviderAnthropic:
-	// 	return database.MessageUnion{
-	// 		OfAnthropic: &anthropic.MessageParam{
-	// 			Role: anthropic.MessageParamRoleUser,
-	// 			Content: []anthropic.ContentBlockParamUnion{
-	// 				{OfText: &anthropic.TextBlockParam{Text: message}},
-	// 			},
-	// 		},
-	// 	}, nil
+	case database.ModelProviderAnthropic:
+		return database.MessageUnion{
+			OfAnthropic: &anthropic.MessageParam{
+				Role: anthropic.MessageParamRoleUser,
+				Content: []anthropic.ContentBlockParamUnion{
+					{OfText: &anthropic.TextBlockParam{Text: message}},
+				},
+			},
+		}, nil
+	default:
+		return database.MessageUnion{}, fmt.Errorf("unsupported model provider: %s", provider)
+	}
+}
+
+func newAssistantMessage(message string, provider database.ModelProvider) (database.MessageUnion, error) {
+	switch provider {
+	case database.ModelProviderOpenAI:
+		return database.MessageUnion{
+			OfOpenAI: &openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: message,
+			},
+		}, nil
+	case database.ModelProviderAnthropic:
+		return database.MessageUnion{
+			OfAnthropic: &anthropic.MessageParam{
+				Role: anthropic.MessageParamRoleAssistant,
+				Content: []anthropic.ContentBlockParamUnion{
+					{OfText: &anthropic.TextBlockParam{Text: message}},
+				},
+			},
+		}, nil
 	default:
 		return database.MessageUnion{}, fmt.Errorf("unsupported model provider: %s", provider)
 	}
@@ -249,7 +310,7 @@ func (sm *SessionManager) continueTurnHumanInput() error {
 		messages = append(messages, &sm.history[i].Content)
 	}
 	// Call the agent to complete the turn
-	result, stopReason, err := agent.Completion(sm.ctx, messages, sm.chatCallback)
+	result, stopReason, model, err := agent.Completion(sm.ctx, messages, sm.chatCallback)
 	if err != nil {
 		return fmt.Errorf("failed to complete turn with agent %s: %w", *nextNode.AgentName, err)
 	}
@@ -260,6 +321,7 @@ func (sm *SessionManager) continueTurnHumanInput() error {
 		SessionID:  sm.session.ID,
 		Content:    result,
 		StopReason: stopReason,
+		Model:      model,
 		Node:       nextNode.ID,
 	})
 	if err != nil {
@@ -282,23 +344,57 @@ func (sm *SessionManager) continueTurnToolCall() error {
 	if agent == nil {
 		return fmt.Errorf("agent %s not found in session manager", *lastNode.AgentName)
 	}
-	message, err := agent.ToolUse(sm.ctx, &lastHistory.Content)
+	messages, err := agent.ToolUse(sm.ctx, &lastHistory.Content)
 	if err != nil {
 		return fmt.Errorf("failed to call tool use on agent %s: %w", *lastNode.AgentName, err)
 	}
-	// Store the result to history
-	historyID := uuid.Must(uuid.NewV7())
-	history, err := sm.llm.queries.SessionAddChatHistory(sm.ctx, database.SessionAddChatHistoryParams{
-		ID:         historyID,
-		SessionID:  sm.session.ID,
-		Content:    message,
-		StopReason: database.StopReasonToolResult,
-		Node:       lastNode.ID,
-	})
+	stopReasons := make([]database.StopReason, len(messages))
+	for i := range stopReasons {
+		stopReasons[i] = database.StopReasonToolResult
+	}
+	// Too many consecutive failures end the turn with an explanation instead of another completion
+	var failureMessage string
+	if agent.ToolFailureLimitReached() {
+		failureMessage = agent.ToolFailureMessage()
+		message, err := newAssistantMessage(failureMessage, agent.config.Provider)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+		stopReasons = append(stopReasons, database.StopReasonAgentDone)
+	}
+	// Store the results to history together, the provider rejects a turn missing some of them
+	tx, err := sm.llm.db.Begin(sm.ctx)
 	if err != nil {
-		return fmt.Errorf("failed to add chat history: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(sm.ctx)
+	queries := sm.llm.queries.WithTx(tx)
+	histories := make([]database.SessionHistory, 0, len(messages))
+	for i, message := range messages {
+		historyID := uuid.Must(uuid.NewV7())
+		history, err := queries.SessionAddChatHistory(sm.ctx, database.SessionAddChatHistoryParams{
+			ID:         historyID,
+			SessionID:  sm.session.ID,
+			Content:    message,
+			StopReason: stopReasons[i],
+			Node:       lastNode.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add chat history: %w", err)
+		}
+		histories = append(histories, history)
+	}
+	if err := tx.Commit(sm.ctx); err != nil {
+		return fmt.Errorf("failed to commit chat history: %w", err)
+	}
+	sm.history = append(sm.history, histories...)
+	if failureMessage != "" && sm.chatCallback != nil {
+		if err := sm.chatCallback(failureMessage, false, false); err != nil {
+			return err
+		}
+		return sm.chatCallback("", false, true)
 	}
-	sm.history = append(sm.history, history)
 	return nil
 }
 
@@ -320,7 +416,7 @@ func (sm *SessionManager) continueTurnToolResult() error {
 		messages = append(messages, &sm.history[i].Content)
 	}
 	// Call the agent to complete the turn
-	result, stopReason, err := agent.Completion(sm.ctx, messages, sm.chatCallback)
+	result, stopReason, model, err := agent.Completion(sm.ctx, messages, sm.chatCallback)
 	if err != nil {
 		return fmt.Errorf("failed to complete turn with agent %s: %w", *lastNode.AgentName, err)
 	}
@@ -331,6 +427,7 @@ func (sm *SessionManager) continueTurnToolResult() error {
 		SessionID:  sm.session.ID,
 		Content:    result,
 		StopReason: stopReason,
+		Model:      model,
 		Node:       lastNode.ID,
 	})
 	if err != nil {
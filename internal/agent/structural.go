@@ -0,0 +1,332 @@
+package agent
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// blockKind is the kind of a structural block of a Markdown or HTML document
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockListItem
+	blockTable
+	blockHTMLTable
+	blockCode
+)
+
+// structuralBlock is a block of a document that StructuralChunking keeps in one chunk when it fits
+type structuralBlock struct {
+	kind blockKind
+	span textSpan
+	// level and title are set on headings
+	level int
+	title string
+}
+
+var (
+	markdownHeadingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+	htmlHeadingPattern     = regexp.MustCompile(`(?i)^\s*<h([1-6])[^>]*>(.*?)</h[1-6]>\s*$`)
+	htmlTagPattern         = regexp.MustCompile(`<[^>]*>`)
+	listItemPattern        = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+`)
+	tableSeparatorPattern  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// StructuralChunking splits Markdown or HTML text along its structure. Chunks never cross a
+// heading, and tables, list items and code blocks are only split when they alone exceed
+// chunkSize: tables between rows, repeating the header row in every piece, and the other
+// blocks with RecursiveChunking. Each chunk is prefixed with its heading path, e.g.
+// "Annual report > Balance sheet". Overlap is not applied so blocks stay intact.
+func (c *Chunking) StructuralChunking(text string) []Chunk {
+	text = toValidUTF8(text)
+
+	type heading struct {
+		level int
+		title string
+	}
+	var path []heading
+	var chunks []Chunk
+	current := textSpan{start: -1}
+	prefix := ""
+	budget := c.chunkSize
+
+	flush := func() {
+		if current.start >= 0 {
+			chunks = append(chunks, withHeadingPath(prefix, newChunk(text, current.start, current.end, SeparatorLevelSection)))
+			current = textSpan{start: -1}
+		}
+	}
+
+	for _, block := range parseStructuralBlocks(text) {
+		if block.kind == blockHeading {
+			flush()
+			for len(path) > 0 && path[len(path)-1].level >= block.level {
+				path = path[:len(path)-1]
+			}
+			path = append(path, heading{level: block.level, title: block.title})
+			titles := make([]string, 0, len(path))
+			for _, h := range path {
+				titles = append(titles, h.title)
+			}
+			prefix, budget = c.headingPrefix(titles)
+			continue
+		}
+
+		body := text[block.span.start:block.span.end]
+		if current.start >= 0 && charCount(text[current.start:block.span.end]) <= budget {
+			current.end = block.span.end
+			continue
+		}
+		flush()
+		if charCount(body) <= budget {
+			current = block.span
+			continue
+		}
+
+		switch block.kind {
+		case blockTable:
+			chunks = append(chunks, splitMarkdownTable(text, block.span, prefix, budget)...)
+		case blockHTMLTable:
+			chunks = append(chunks, splitHTMLTable(text, block.span, prefix, budget)...)
+		default:
+			splitter := &Chunking{chunkSize: budget}
+			for _, part := range shiftChunks(splitter.RecursiveChunking(body), block.span.start) {
+				chunks = append(chunks, withHeadingPath(prefix, part))
+			}
+		}
+	}
+	flush()
+	return indexChunks(chunks)
+}
+
+// headingPrefix joins the heading path and returns the room left for content. When the full
+// path leaves less than half of chunkSize only the innermost heading is kept, and no heading at all
+// if even that does not fit.
+func (c *Chunking) headingPrefix(titles []string) (string, int) {
+	if len(titles) == 0 {
+		return "", c.chunkSize
+	}
+	for _, prefix := range []string{strings.Join(titles, " > "), titles[len(titles)-1]} {
+		if budget := c.chunkSize - charCount(prefix) - 1; budget >= c.chunkSize/2 {
+			return prefix, budget
+		}
+	}
+	return "", c.chunkSize
+}
+
+func withHeadingPath(prefix string, chunk Chunk) Chunk {
+	if prefix != "" {
+		chunk.Text = prefix + "\n" + chunk.Text
+	}
+	return chunk
+}
+
+// splitMarkdownTable splits a Markdown table between rows. Every piece after the first
+// repeats the header row and its separator. A single row larger than budget is kept whole.
+func splitMarkdownTable(text string, span textSpan, prefix string, budget int) []Chunk {
+	rows := splitSpans(text, span, "\n")
+	headerRows := 1
+	if len(rows) > 1 && tableSeparatorPattern.MatchString(text[rows[1].start:rows[1].end]) {
+		headerRows = 2
+	}
+	if len(rows) <= headerRows {
+		return []Chunk{withHeadingPath(prefix, newChunk(text, span.start, span.end, SeparatorLevelTable))}
+	}
+	header := text[rows[0].start:rows[headerRows-1].end]
+	return packTableRows(text, rows[headerRows:], rows[0].start, header+"\n", "", prefix, budget)
+}
+
+// splitHTMLTable splits an HTML table between <tr> rows. The first row is repeated in every
+// piece when it holds <th> cells, and every piece is wrapped in its own <table> element.
+func splitHTMLTable(text string, span textSpan, prefix string, budget int) []Chunk {
+	var rows []textSpan
+	lower := strings.ToLower(text[span.start:span.end])
+	for offset := 0; ; {
+		i := strings.Index(lower[offset:], "<tr")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(lower[offset+i:], "</tr>")
+		if j < 0 {
+			break
+		}
+		rows = append(rows, textSpan{span.start + offset + i, span.start + offset + i + j + len("</tr>")})
+		offset += i + j + len("</tr>")
+	}
+	if len(rows) == 0 {
+		splitter := &Chunking{chunkSize: budget}
+		var chunks []Chunk
+		for _, part := range shiftChunks(splitter.RecursiveChunking(text[span.start:span.end]), span.start) {
+			chunks = append(chunks, withHeadingPath(prefix, part))
+		}
+		return chunks
+	}
+	header := ""
+	if strings.Contains(strings.ToLower(text[rows[0].start:rows[0].end]), "<th") {
+		header = text[rows[0].start:rows[0].end] + "\n"
+		rows = rows[1:]
+	}
+	return packTableRows(text, rows, span.start, "<table>\n"+header, "\n</table>", prefix, budget)
+}
+
+// packTableRows groups rows into chunks of at most budget characters, each wrapped in head and tail.
+// The first chunk starts at start so it covers the header of the table in the source.
+func packTableRows(text string, rows []textSpan, start int, head, tail, prefix string, budget int) []Chunk {
+	var chunks []Chunk
+	current := textSpan{start: -1}
+	fits := func(s textSpan) bool {
+		return charCount(head)+charCount(text[s.start:s.end])+charCount(tail) <= budget
+	}
+	flush := func() {
+		if current.start < 0 {
+			return
+		}
+		chunk := newChunk(text, current.start, current.end, SeparatorLevelTable)
+		chunk.Text = head + chunk.Text + tail
+		if len(chunks) == 0 {
+			chunk.Start = start
+		}
+		chunks = append(chunks, withHeadingPath(prefix, chunk))
+		current = textSpan{start: -1}
+	}
+	for _, row := range rows {
+		if current.start >= 0 && fits(textSpan{current.start, row.end}) {
+			current.end = row.end
+			continue
+		}
+		flush()
+		current = row
+	}
+	flush()
+	return chunks
+}
+
+// parseStructuralBlocks splits text into headings, paragraphs, list items, tables and code blocks
+func parseStructuralBlocks(text string) []structuralBlock {
+	lines := splitLines(text)
+	var blocks []structuralBlock
+	lineText := func(i int) string {
+		return text[lines[i].start:lines[i].end]
+	}
+	isBlank := func(i int) bool {
+		return strings.TrimSpace(lineText(i)) == ""
+	}
+	startsBlock := func(i int) bool {
+		line := lineText(i)
+		trimmed := strings.TrimSpace(line)
+		return markdownHeadingPattern.MatchString(line) ||
+			htmlHeadingPattern.MatchString(line) ||
+			listItemPattern.MatchString(line) ||
+			strings.HasPrefix(trimmed, "|") ||
+			strings.HasPrefix(trimmed, "```") ||
+			strings.Contains(strings.ToLower(line), "<table")
+	}
+
+	for i := 0; i < len(lines); {
+		line := lineText(i)
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+
+		case markdownHeadingPattern.MatchString(line):
+			m := markdownHeadingPattern.FindStringSubmatch(line)
+			blocks = append(blocks, structuralBlock{kind: blockHeading, span: lines[i], level: len(m[1]), title: m[2]})
+			i++
+
+		case htmlHeadingPattern.MatchString(line):
+			m := htmlHeadingPattern.FindStringSubmatch(line)
+			title := strings.TrimSpace(htmlTagPattern.ReplaceAllString(m[2], ""))
+			blocks = append(blocks, structuralBlock{kind: blockHeading, span: lines[i], level: int(m[1][0] - '0'), title: title})
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lineText(j)), "```") {
+				j++
+			}
+			end := min(j, len(lines)-1)
+			blocks = append(blocks, structuralBlock{kind: blockCode, span: textSpan{lines[i].start, lines[end].end}})
+			i = end + 1
+
+		case strings.HasPrefix(trimmed, "|"):
+			j := i
+			for j+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lineText(j+1)), "|") {
+				j++
+			}
+			blocks = append(blocks, structuralBlock{kind: blockTable, span: textSpan{lines[i].start, lines[j].end}})
+			i = j + 1
+
+		case strings.Contains(strings.ToLower(line), "<table"):
+			j := i
+			for j < len(lines)-1 && !strings.Contains(strings.ToLower(lineText(j)), "</table>") {
+				j++
+			}
+			blocks = append(blocks, structuralBlock{kind: blockHTMLTable, span: textSpan{lines[i].start, lines[j].end}})
+			i = j + 1
+
+		case listItemPattern.MatchString(line):
+			// Indented lines, including nested list items, belong to the item
+			indent := len(listItemPattern.FindStringSubmatch(line)[1])
+			j := i
+			for j+1 < len(lines) && !isBlank(j+1) {
+				next := lineText(j + 1)
+				nextIndent := len(next) - len(strings.TrimLeftFunc(next, unicode.IsSpace))
+				if nextIndent <= indent && startsBlock(j+1) {
+					break
+				}
+				j++
+			}
+			blocks = append(blocks, structuralBlock{kind: blockListItem, span: textSpan{lines[i].start, lines[j].end}})
+			i = j + 1
+
+		default:
+			j := i
+			for j+1 < len(lines) && !isBlank(j+1) && !startsBlock(j+1) {
+				// Setext headings underline their title with = or -
+				if underline := strings.TrimSpace(lineText(j + 1)); j == i && isSetextUnderline(underline) {
+					break
+				}
+				j++
+			}
+			if j == i && j+1 < len(lines) && isSetextUnderline(strings.TrimSpace(lineText(j+1))) {
+				level := 1
+				if strings.HasPrefix(strings.TrimSpace(lineText(j+1)), "-") {
+					level = 2
+				}
+				blocks = append(blocks, structuralBlock{kind: blockHeading, span: textSpan{lines[i].start, lines[j+1].end}, level: level, title: trimmed})
+				i = j + 2
+				continue
+			}
+			blocks = append(blocks, structuralBlock{kind: blockParagraph, span: textSpan{lines[i].start, lines[j].end}})
+			i = j + 1
+		}
+	}
+	return blocks
+}
+
+// splitLines returns the spans of the lines of text, without their line breaks
+func splitLines(text string) []textSpan {
+	var lines []textSpan
+	start := 0
+	for start <= len(text) {
+		i := strings.IndexByte(text[start:], '\n')
+		if i < 0 {
+			lines = append(lines, textSpan{start, len(text)})
+			break
+		}
+		lines = append(lines, textSpan{start, start + i})
+		start += i + 1
+	}
+	return lines
+}
+
+func isSetextUnderline(line string) bool {
+	if len(line) < 2 {
+		return false
+	}
+	return strings.Trim(line, "=") == "" || strings.Trim(line, "-") == ""
+}
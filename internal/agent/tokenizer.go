@@ -0,0 +1,264 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Tokenizer converts text to model tokens, so chunk sizes can be measured the way the model counts them
+type Tokenizer interface {
+	Encode(text string) []int
+	Decode(tokens []int) string
+	Count(text string) int
+}
+
+// DefaultTokenizerFile is the cl100k_base vocabulary in tiktoken format, downloadable from
+// https://openaipublic.blob.core.windows.net/encodings/cl100k_base.tiktoken
+var DefaultTokenizerFile = getEnv("TOKENIZER_VOCAB_FILE", "schema/tokenizer/cl100k_base.tiktoken")
+
+var (
+	defaultTokenizer     *BPETokenizer
+	defaultTokenizerErr  error
+	defaultTokenizerOnce sync.Once
+)
+
+// DefaultTokenizer loads the tokenizer from DefaultTokenizerFile once and caches it
+func DefaultTokenizer() (Tokenizer, error) {
+	defaultTokenizerOnce.Do(func() {
+		defaultTokenizer, defaultTokenizerErr = LoadBPETokenizer(DefaultTokenizerFile)
+	})
+	if defaultTokenizerErr != nil {
+		return nil, defaultTokenizerErr
+	}
+	return defaultTokenizer, nil
+}
+
+// BPETokenizer is a byte level BPE tokenizer compatible with tiktoken's cl100k_base encoding
+type BPETokenizer struct {
+	encoder map[string]int
+	decoder map[int][]byte
+}
+
+// LoadBPETokenizer reads a vocabulary in tiktoken format: one "<base64 token> <rank>" per line
+func LoadBPETokenizer(path string) (*BPETokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tokenizer vocabulary: %w", err)
+	}
+	defer f.Close()
+
+	t := &BPETokenizer{
+		encoder: make(map[string]int),
+		decoder: make(map[int][]byte),
+	}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid tokenizer vocabulary at line %d", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token at line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank at line %d: %w", line, err)
+		}
+		t.encoder[string(token)] = rank
+		t.decoder[rank] = token
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer vocabulary: %w", err)
+	}
+	// Byte level BPE can encode any input only if every single byte is a token
+	for b := 0; b < 256; b++ {
+		if _, ok := t.encoder[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("tokenizer vocabulary has no token for byte %d", b)
+		}
+	}
+	return t, nil
+}
+
+func (t *BPETokenizer) Encode(text string) []int {
+	var tokens []int
+	for _, piece := range pretokenize(text) {
+		if rank, ok := t.encoder[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		tokens = append(tokens, t.bytePairEncode([]byte(piece))...)
+	}
+	return tokens
+}
+
+func (t *BPETokenizer) Decode(tokens []int) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.Write(t.decoder[token])
+	}
+	return sb.String()
+}
+
+func (t *BPETokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// bytePairEncode repeatedly merges the adjacent pair of parts with the lowest rank, as tiktoken does
+func (t *BPETokenizer) bytePairEncode(piece []byte) []int {
+	// parts holds the start offsets of the current parts, plus len(piece)
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+	rankOf := func(i int) int {
+		if i+2 >= len(parts) {
+			return math.MaxInt
+		}
+		if rank, ok := t.encoder[string(piece[parts[i]:parts[i+2]])]; ok {
+			return rank
+		}
+		return math.MaxInt
+	}
+	for len(parts) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-2; i++ {
+			if rank := rankOf(i); rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	tokens := make([]int, 0, len(parts)-1)
+	for i := 0; i < len(parts)-1; i++ {
+		tokens = append(tokens, t.encoder[string(piece[parts[i]:parts[i+1]])])
+	}
+	return tokens
+}
+
+// pretokenize splits text the way the cl100k_base pattern does:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// Go's regexp has no lookahead, so the pattern is implemented by hand.
+func pretokenize(text string) []string {
+	runes := []rune(text)
+	var pieces []string
+	for i := 0; i < len(runes); {
+		n := matchPiece(runes, i)
+		pieces = append(pieces, string(runes[i:i+n]))
+		i += n
+	}
+	return pieces
+}
+
+// matchPiece returns the number of runes of the piece starting at i, always at least one
+func matchPiece(runes []rune, i int) int {
+	isNewline := func(r rune) bool { return r == '\r' || r == '\n' }
+	isLetter := func(j int) bool { return j < len(runes) && unicode.IsLetter(runes[j]) }
+	isNumber := func(j int) bool { return j < len(runes) && unicode.IsNumber(runes[j]) }
+	isSpace := func(j int) bool { return j < len(runes) && unicode.IsSpace(runes[j]) }
+	r := runes[i]
+
+	// Contractions
+	if r == '\'' && i+1 < len(runes) {
+		next := unicode.ToLower(runes[i+1])
+		switch next {
+		case 's', 't', 'm', 'd':
+			return 2
+		}
+		if i+2 < len(runes) {
+			pair := string([]rune{next, unicode.ToLower(runes[i+2])})
+			if pair == "re" || pair == "ve" || pair == "ll" {
+				return 3
+			}
+		}
+	}
+
+	// Words, optionally preceded by one non letter, non number character
+	j := i
+	if !isLetter(j) && !isNumber(j) && !isNewline(r) && isLetter(j+1) {
+		j++
+	}
+	if isLetter(j) {
+		for isLetter(j) {
+			j++
+		}
+		return j - i
+	}
+
+	// Numbers of up to three digits
+	if isNumber(i) {
+		j = i
+		for isNumber(j) && j-i < 3 {
+			j++
+		}
+		return j - i
+	}
+
+	// Punctuation, optionally preceded by a space and followed by new lines
+	j = i
+	if r == ' ' {
+		j++
+	}
+	isPunct := func(k int) bool { return k < len(runes) && !isSpace(k) && !isLetter(k) && !isNumber(k) }
+	if isPunct(j) {
+		for isPunct(j) {
+			j++
+		}
+		for j < len(runes) && isNewline(runes[j]) {
+			j++
+		}
+		return j - i
+	}
+
+	// White space: up to the last new line, else all but the last space before a non space
+	end := i
+	for isSpace(end) {
+		end++
+	}
+	for k := end - 1; k >= i; k-- {
+		if isNewline(runes[k]) {
+			return k + 1 - i
+		}
+	}
+	if end < len(runes) && end-i > 1 {
+		return end - 1 - i
+	}
+	return end - i
+}
+
+// tokenBoundaries returns the byte offsets of the token boundaries of text, from 0 to len(text).
+// Offsets are moved back to the start of a character so slicing text at them yields valid UTF-8
+// and never separates a letter from its diacritics.
+func tokenBoundaries(t Tokenizer, text string) []int {
+	tokens := t.Encode(text)
+	offsets := make([]int, 0, len(tokens)+1)
+	offset := 0
+	offsets = append(offsets, 0)
+	for _, token := range tokens {
+		offset += len(t.Decode([]int{token}))
+		boundary := min(offset, len(text))
+		for !isGraphemeBoundary(text, boundary) {
+			boundary--
+		}
+		offsets = append(offsets, boundary)
+	}
+	offsets[len(offsets)-1] = len(text)
+	return offsets
+}
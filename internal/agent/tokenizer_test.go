@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The expected pieces were checked against the cl100k_base pattern run by a PCRE engine
+func TestPretokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "contractions",
+			text: "I'm sure they've left, don't WE'LL see",
+			want: []string{"I", "'m", " sure", " they", "'ve", " left", ",", " don", "'t", " WE", "'LL", " see"},
+		},
+		{
+			name: "stacked contractions",
+			text: "don't'd",
+			want: []string{"don", "'t", "'d"},
+		},
+		{
+			name: "number runs",
+			text: "1234567 and 1,000,000.50",
+			want: []string{"123", "456", "7", " and", " ", "1", ",", "000", ",", "000", ".", "50"},
+		},
+		{
+			name: "vietnamese",
+			text: "Thị trường chứng khoán Việt Nam",
+			want: []string{"Thị", " trường", " chứng", " khoán", " Việt", " Nam"},
+		},
+		{
+			name: "vietnamese with numbers",
+			text: "Giá cổ phiếu tăng 12,5% trong năm 2024.",
+			want: []string{"Giá", " cổ", " phiếu", " tăng", " ", "12", ",", "5", "%", " trong", " năm", " ", "202", "4", "."},
+		},
+		{
+			name: "combining mark",
+			text: "e\u0301 combining",
+			want: []string{"e", "\u0301", " combining"},
+		},
+		{
+			name: "cjk punctuation",
+			text: "hello world!你好，世界！",
+			want: []string{"hello", " world", "!你好", "，世界", "！"},
+		},
+		{
+			name: "new lines",
+			text: "line one\n\n  line two\r\n\tend  ",
+			want: []string{"line", " one", "\n\n", " ", " line", " two", "\r\n", "\tend", "  "},
+		},
+		{
+			name: "spaces before words",
+			text: "  leading spaces   and  trailing   ",
+			want: []string{" ", " leading", " spaces", "  ", " and", " ", " trailing", "   "},
+		},
+		{
+			name: "punctuation runs",
+			text: "price: $42.99!!\n\n",
+			want: []string{"price", ":", " $", "42", ".", "99", "!!\n\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pretokenize(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("pretokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestBPETokenizer loads a vocabulary of the 256 bytes, ranked by value, and a few merged
+// tokens, so tests need no downloaded vocabulary
+func newTestBPETokenizer(t *testing.T) *BPETokenizer {
+	t.Helper()
+	var vocab strings.Builder
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	for rank, token := range []string{"lo", "low", "er", "ow", " low"} {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), 256+rank)
+	}
+	path := filepath.Join(t.TempDir(), "vocab.tiktoken")
+	if err := os.WriteFile(path, []byte(vocab.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tokenizer, err := LoadBPETokenizer(path)
+	if err != nil {
+		t.Fatalf("failed to load tokenizer: %v", err)
+	}
+	return tokenizer
+}
+
+func TestBytePairEncode(t *testing.T) {
+	tokenizer := newTestBPETokenizer(t)
+	tests := []struct {
+		text string
+		want []int
+	}{
+		// "lo" (256) is merged before "ow" (259), then "low" (257) and "er" (258)
+		{text: "lower", want: []int{257, 258}},
+		// A piece found in the vocabulary is a single token
+		{text: " low", want: []int{260}},
+		// Pieces are encoded separately, "lo" and "w" are in different pieces
+		{text: "lo-w", want: []int{256, '-', 'w'}},
+		{text: "xyz", want: []int{'x', 'y', 'z'}},
+		{text: "", want: nil},
+	}
+	for _, tt := range tests {
+		if got := tokenizer.Encode(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+		if got := tokenizer.Decode(tokenizer.Encode(tt.text)); got != tt.text {
+			t.Errorf("Decode(Encode(%q)) = %q", tt.text, got)
+		}
+	}
+}
+
+// loadTestTokenizer loads the cl100k_base vocabulary, the test is skipped when it was not downloaded
+func loadTestTokenizer(t *testing.T) *BPETokenizer {
+	t.Helper()
+	path := os.Getenv("TOKENIZER_VOCAB_FILE")
+	if path == "" {
+		path = filepath.Join("..", "..", "schema", "tokenizer", "cl100k_base.tiktoken")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("cl100k_base vocabulary not found at %s, see the README to download it", path)
+	}
+	tokenizer, err := LoadBPETokenizer(path)
+	if err != nil {
+		t.Fatalf("failed to load tokenizer: %v", err)
+	}
+	return tokenizer
+}
+
+func TestBPETokenizerEncode(t *testing.T) {
+	tokenizer := loadTestTokenizer(t)
+	tests := []struct {
+		name string
+		text string
+		// ids are the token IDs returned by tiktoken's cl100k_base encoding
+		ids []int
+		// tokens are the decoded tokens, for texts whose IDs are not listed
+		tokens []string
+	}{
+		{
+			name: "words",
+			text: "hello world",
+			ids:  []int{15339, 1917},
+		},
+		{
+			name: "punctuation",
+			text: "Hello, world!",
+			ids:  []int{9906, 11, 1917, 0},
+		},
+		{
+			name: "merged word",
+			text: "tiktoken is great!",
+			ids:  []int{83, 1609, 5963, 374, 2294, 0},
+		},
+		{
+			name: "multi-byte characters",
+			text: "hello world!你好，世界！",
+			ids:  []int{15339, 1917, 0, 57668, 53901, 3922, 3574, 244, 98220, 6447},
+		},
+		{
+			name:   "contractions",
+			text:   "I'm sure they've left, don't",
+			tokens: []string{"I", "'m", " sure", " they", "'ve", " left", ",", " don", "'t"},
+		},
+		{
+			name:   "number runs",
+			text:   "1234567 and 1,000,000",
+			tokens: []string{"123", "456", "7", " and", " ", "1", ",", "000", ",", "000"},
+		},
+		{
+			name: "vietnamese",
+			text: "Thị trường chứng khoán Việt Nam tăng 12,5% trong năm 2024.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := tokenizer.Encode(tt.text)
+			if tt.ids != nil && !slices.Equal(ids, tt.ids) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, ids, tt.ids)
+			}
+			if tt.tokens != nil {
+				tokens := make([]string, 0, len(ids))
+				for _, id := range ids {
+					tokens = append(tokens, tokenizer.Decode([]int{id}))
+				}
+				if !slices.Equal(tokens, tt.tokens) {
+					t.Errorf("Encode(%q) decodes to %q, want %q", tt.text, tokens, tt.tokens)
+				}
+			}
+			if got := tokenizer.Decode(ids); got != tt.text {
+				t.Errorf("Decode(Encode(%q)) = %q", tt.text, got)
+			}
+			if got := tokenizer.Count(tt.text); got != len(ids) {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, got, len(ids))
+			}
+		})
+	}
+}
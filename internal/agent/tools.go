@@ -0,0 +1,292 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"stockmind/internal/database"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// defaultToolConcurrency is the number of tool calls of one turn run at the same time
+	defaultToolConcurrency = 4
+	// defaultToolTimeout bounds a single tool call
+	defaultToolTimeout = 60 * time.Second
+	// defaultMaxToolFailures is the number of consecutive failed tool calls ending the turn
+	defaultMaxToolFailures = 3
+)
+
+// toolCall is a tool call requested by the model, whatever the provider
+type toolCall struct {
+	ID        string
+	Name      string
+	Arguments any
+	// Err is set when the call cannot be made, such as with malformed arguments
+	Err error
+}
+
+// exposedTools merges the tools discovered from the MCP servers with the static tools of the
+// agent config and keeps those the allow and deny lists let through. Patterns are matched
+// against the full tool name, "<mcp>--<tool>" for MCP tools. An empty allow list allows every
+// tool and the deny list wins over the allow list.
+func exposedTools(discovered, static []mcp.Tool, allowed, denied []string) []mcp.Tool {
+	tools := make([]mcp.Tool, 0, len(discovered)+len(static))
+	seen := make(map[string]bool, len(discovered)+len(static))
+	for _, tool := range slices.Concat(discovered, static) {
+		if seen[tool.Name] {
+			fmt.Println("Duplicate tool name, keeping the first one", "tool_name", tool.Name)
+			continue
+		}
+		seen[tool.Name] = true
+		if len(allowed) > 0 && !matchToolPattern(allowed, tool.Name) {
+			continue
+		}
+		if matchToolPattern(denied, tool.Name) {
+			continue
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// matchToolPattern reports whether name matches any of the glob patterns
+func matchToolPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// Patterns are validated when the flow is loaded
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateToolPatterns checks the syntax of the allow and deny lists
+func validateToolPatterns(field string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q: %w", field, pattern, err)
+		}
+	}
+	return nil
+}
+
+// validateStaticTools checks every static tool is named "<mcp>--<tool>" after an MCP server of
+// the agent. Tool calls are only dispatched through MCP clients, so a static tool declares the
+// schema of a tool served by one of them and any other name could never run.
+func validateStaticTools(cfg database.AgentConfig) error {
+	servers := make(map[string]bool, len(cfg.McpServers))
+	for _, server := range cfg.McpServers {
+		servers[server.Name] = true
+	}
+	for _, tool := range cfg.Tools {
+		mcpName, toolName, ok := strings.Cut(tool.Name, "--")
+		if !ok || mcpName == "" || toolName == "" {
+			return fmt.Errorf("static tool %q must be named <mcp>--<tool> after one of the mcpServers", tool.Name)
+		}
+		if !servers[mcpName] {
+			return fmt.Errorf("static tool %q references MCP server %s which is not in mcpServers", tool.Name, mcpName)
+		}
+	}
+	return nil
+}
+
+// hasTool reports whether the tool is exposed to the model, so calls to filtered out or
+// hallucinated tools are refused
+func (a *Agent) hasTool(name string) bool {
+	for _, tool := range a.tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// toolParameters returns the JSON schema of the tool arguments, preferring the raw schema
+// when the tool was declared with one
+func toolParameters(tool mcp.Tool) any {
+	if len(tool.RawInputSchema) > 0 {
+		return json.RawMessage(tool.RawInputSchema)
+	}
+	return tool.InputSchema
+}
+
+// callTools runs the independent tool calls of one assistant turn concurrently, at most
+// toolConcurrency at a time, and returns the results in the order of the calls. A failed call
+// becomes an error result the model can react to, only the cancellation of ctx fails the turn.
+func (a *Agent) callTools(ctx context.Context, calls []toolCall) ([]*mcp.CallToolResult, error) {
+	limit := int(a.config.ToolConcurrency)
+	if limit <= 0 {
+		limit = defaultToolConcurrency
+	}
+	results := make([]*mcp.CallToolResult, len(calls))
+	errs := make([]error, len(calls))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		if call.Err != nil {
+			errs[i] = call.Err
+			continue
+		}
+		wg.Go(func() {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("failed to call tool %s: %w", call.Name, ctx.Err())
+				return
+			}
+			defer func() { <-sem }()
+			results[i], errs[i] = a.callTool(ctx, call)
+		})
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("tool calls were cancelled: %w", err)
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			results[i] = mcp.NewToolResultError(err.Error())
+		}
+		a.recordToolResult(calls[i], results[i])
+	}
+	return results, nil
+}
+
+// recordToolResult counts the consecutive failed tool calls of the agent, a successful call
+// resets the count
+func (a *Agent) recordToolResult(call toolCall, result *mcp.CallToolResult) {
+	if !result.IsError {
+		a.toolFailures = 0
+		return
+	}
+	a.toolFailures++
+	a.lastToolError = toolResultText(result)
+	fmt.Println("Tool call failed", "sessionId", a.session.ID, "agentName", a.name, "tool_name", call.Name, "consecutive_failures", a.toolFailures, "error", a.lastToolError)
+}
+
+// ToolFailureLimitReached reports whether the consecutive failed tool calls reached the limit
+// of the agent, in which case the turn should end instead of calling the model again
+func (a *Agent) ToolFailureLimitReached() bool {
+	limit := a.config.MaxToolFailures
+	if limit <= 0 {
+		limit = defaultMaxToolFailures
+	}
+	return int64(a.toolFailures) >= limit
+}
+
+// ToolFailureMessage explains to the user why the turn ended and resets the failure count
+func (a *Agent) ToolFailureMessage() string {
+	message := fmt.Sprintf("I stopped because the last %d tool calls failed. The last error was: %s", a.toolFailures, a.lastToolError)
+	a.toolFailures = 0
+	a.lastToolError = ""
+	return message
+}
+
+// toolResultText joins the text content of a tool result
+func toolResultText(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// callTool calls an MCP tool named <mcp>--<tool_name> within the tool timeout of the agent
+func (a *Agent) callTool(ctx context.Context, call toolCall) (*mcp.CallToolResult, error) {
+	fmt.Println("Invoking tool", "name", call.Name, "input", call.Arguments)
+	if !a.hasTool(call.Name) {
+		fmt.Println("Tool is not exposed to the agent", "sessionId", a.session.ID, "agentName", a.name, "tool_name", call.Name)
+		return nil, fmt.Errorf("tool %s is not exposed to the agent", call.Name)
+	}
+	parts := strings.SplitN(call.Name, "--", 2)
+	if len(parts) != 2 {
+		fmt.Println("Invalid tool name format, expected <mcp>--<tool_name>", "sessionId", a.session.ID, "agentName", a.name, "tool_name", call.Name)
+		return nil, fmt.Errorf("invalid tool name format, expected <mcp>--<tool_name>")
+	}
+	mcpName := parts[0]
+	toolName := parts[1]
+	mcpClient, ok := a.mcpClients[mcpName]
+	if !ok {
+		fmt.Println("MCP client not found", "sessionId", a.session.ID, "agentName", a.name, "mcpName", mcpName)
+		return nil, fmt.Errorf("MCP client not found: %s", mcpName)
+	}
+
+	timeout := defaultToolTimeout
+	if a.config.ToolTimeout > 0 {
+		timeout = time.Duration(a.config.ToolTimeout) * time.Second
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	toolResponse, err := mcpClient.CallTool(callCtx, mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Name:      toolName,
+			Arguments: call.Arguments,
+			Meta: &mcp.Meta{
+				AdditionalFields: map[string]any{
+					"user_id":    a.session.CreatedBy,
+					"session_id": a.session.ID,
+				},
+			},
+		},
+	})
+	if err != nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	if err != nil {
+		fmt.Println("Failed to call tool", "sessionId", a.session.ID, "agentName", a.name, "toolName", call.Name, "error", err)
+		return nil, fmt.Errorf("failed to call tool %s: %w", call.Name, err)
+	}
+	fmt.Println("Tool result: ", "sessionId", a.session.ID, "agentName", a.name, "tool_id", call.ID, "tool_name", call.Name, "content_count", len(toolResponse.Content))
+	return toolResponse, nil
+}
+
+// structuredContentText serializes the structured content of a tool result. Tools should also
+// return it as text, so it is only added when the result has no text content.
+func structuredContentText(result *mcp.CallToolResult) (string, bool) {
+	if result.StructuredContent == nil {
+		return "", false
+	}
+	for _, content := range result.Content {
+		if _, ok := content.(mcp.TextContent); ok {
+			return "", false
+		}
+	}
+	data, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// resourceText renders a text resource embedded in a tool result
+func resourceText(resource mcp.TextResourceContents) string {
+	return fmt.Sprintf("Resource %s:\n%s", resource.URI, resource.Text)
+}
+
+// resourceLinkText renders a link to a resource the model may read with another tool
+func resourceLinkText(link mcp.ResourceLink) string {
+	text := fmt.Sprintf("Resource link %s (%s)", link.Name, link.URI)
+	if link.MIMEType != "" {
+		text += ", " + link.MIMEType
+	}
+	if link.Description != "" {
+		text += ": " + link.Description
+	}
+	return text
+}
+
+// omittedContentText stands in for content the provider cannot receive in a tool result
+func omittedContentText(kind, mimeType string) string {
+	return fmt.Sprintf("[%s content of type %s returned by the tool is not supported by the model]", kind, mimeType)
+}
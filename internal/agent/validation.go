@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"stockmind/internal/database"
+)
+
+// minAnthropicThinkingTokens is the smallest thinking budget the Messages API accepts
+const minAnthropicThinkingTokens = 1024
+
+// minAnthropicThinkingTopP is the smallest top_p the Messages API accepts with extended thinking
+const minAnthropicThinkingTopP = 0.95
+
+// ValidateFlowConfig checks the nodes, the models and the sampling parameters of every agent of a flow
+// against the configured providers, so a misconfigured flow fails when it is loaded rather
+// than in the middle of a conversation
+func ValidateFlowConfig(flow database.AgentFlowConfig, providers LLMProviderConfig) error {
+	var errs []error
+	for _, node := range flow.Nodes {
+		if node.Type != database.NodeTypeAgent {
+			continue
+		}
+		if node.AgentName == nil {
+			errs = append(errs, fmt.Errorf("node %s: agentName is required for agent nodes", node.ID))
+			continue
+		}
+		if _, ok := flow.Agents[*node.AgentName]; !ok {
+			errs = append(errs, fmt.Errorf("node %s: agent %s is not defined", node.ID, *node.AgentName))
+		}
+	}
+	for name, cfg := range flow.Agents {
+		if err := validateAgentConfig(cfg, providers); err != nil {
+			errs = append(errs, fmt.Errorf("agent %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateAgentConfig(cfg database.AgentConfig, providers LLMProviderConfig) error {
+	if cfg.MaxTokens < 0 {
+		return fmt.Errorf("maxTokens must not be negative, got %d", cfg.MaxTokens)
+	}
+	if cfg.TopP < 0 || cfg.TopP > 1 {
+		return fmt.Errorf("topP must be between 0 and 1, got %g", cfg.TopP)
+	}
+	if cfg.TopK < 0 {
+		return fmt.Errorf("topK must not be negative, got %d", cfg.TopK)
+	}
+	if cfg.ThinkingToken < 0 {
+		return fmt.Errorf("thinkingToken must not be negative, got %d", cfg.ThinkingToken)
+	}
+	if cfg.ToolConcurrency < 0 {
+		return fmt.Errorf("toolConcurrency must not be negative, got %d", cfg.ToolConcurrency)
+	}
+	if cfg.ToolTimeout < 0 {
+		return fmt.Errorf("toolTimeout must not be negative, got %d", cfg.ToolTimeout)
+	}
+	if cfg.MaxToolFailures < 0 {
+		return fmt.Errorf("maxToolFailures must not be negative, got %d", cfg.MaxToolFailures)
+	}
+	if err := validateToolPatterns("allowedTools", cfg.AllowedTools); err != nil {
+		return err
+	}
+	if err := validateToolPatterns("deniedTools", cfg.DeniedTools); err != nil {
+		return err
+	}
+	if err := validateStaticTools(cfg); err != nil {
+		return err
+	}
+
+	var err error
+	switch cfg.Provider {
+	case database.ModelProviderOpenAI:
+		err = validateOpenAIConfig(cfg, providers.OpenAI)
+	case database.ModelProviderAnthropic:
+		err = validateAnthropicConfig(cfg)
+	default:
+		err = fmt.Errorf("unsupported model provider: %s", cfg.Provider)
+	}
+	if err != nil {
+		return err
+	}
+	if err := validateModel(cfg); err != nil {
+		return err
+	}
+	if err := validateRetrieval(cfg); err != nil {
+		return err
+	}
+	if err := validateRetryPolicy(cfg.Retry); err != nil {
+		return err
+	}
+
+	// A fallback model receives the same request as the agent model
+	for i, fallback := range cfg.Fallbacks {
+		fallbackCfg := cfg
+		fallbackCfg.ModelID = fallback.ModelID
+		if fallback.Provider != "" {
+			fallbackCfg.Provider = fallback.Provider
+		}
+		fallbackCfg.Fallbacks = nil
+		// The llm reranker keeps the agent model, it is only checked against the agent provider
+		fallbackCfg.Retrieval = nil
+		if err := validateAgentConfig(fallbackCfg, providers); err != nil {
+			return fmt.Errorf("fallback %d (%s): %w", i+1, fallback.ModelID, err)
+		}
+	}
+	return nil
+}
+
+func validateRetryPolicy(policy *database.RetryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxAttempts < 0 {
+		return fmt.Errorf("retry.maxAttempts must not be negative, got %d", policy.MaxAttempts)
+	}
+	if policy.InitialBackoff < 0 || policy.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoffs must not be negative")
+	}
+	if policy.MaxBackoff > 0 && policy.InitialBackoff > policy.MaxBackoff {
+		return fmt.Errorf("retry.initialBackoff (%d) must not exceed retry.maxBackoff (%d)", policy.InitialBackoff, policy.MaxBackoff)
+	}
+	for _, code := range policy.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retryable status code %d", code)
+		}
+	}
+	return nil
+}
+
+// validateModel checks the model is registered and able to serve the agent
+func validateModel(cfg database.AgentConfig) error {
+	model, err := ResolveModel(cfg.Provider, cfg.ModelID)
+	if err != nil {
+		return err
+	}
+	if !model.ToolCalling && (len(cfg.Tools) > 0 || len(cfg.McpServers) > 0) {
+		return fmt.Errorf("model %s does not support tool calling, remove the tools and mcpServers of the agent", cfg.ModelID)
+	}
+	if cfg.MaxTokens > model.ContextWindow {
+		return fmt.Errorf("maxTokens (%d) exceeds the context window of model %s (%d)", cfg.MaxTokens, cfg.ModelID, model.ContextWindow)
+	}
+	return nil
+}
+
+// validateRetrieval checks the model of the llm reranker is registered for the agent provider.
+// The reranker sends a single request without tools, so the model needs no tool calling.
+func validateRetrieval(cfg database.AgentConfig) error {
+	r := cfg.Retrieval
+	if r == nil {
+		return nil
+	}
+	if r.Reranker == database.RerankerLLM && cfg.Provider != database.ModelProviderOpenAI {
+		return fmt.Errorf("the %s reranker requires the %s provider", database.RerankerLLM, database.ModelProviderOpenAI)
+	}
+	if r.RerankModel == "" {
+		return nil
+	}
+	if _, err := ResolveModel(cfg.Provider, r.RerankModel); err != nil {
+		return fmt.Errorf("retrieval.rerankModel: %w", err)
+	}
+	return nil
+}
+
+func validateOpenAIConfig(cfg database.AgentConfig, provider OpenAIConfig) error {
+	if t := cfg.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", *t)
+	}
+	// top_k and the reasoning budget are only sent through OpenRouter's extra parameters
+	if provider.AuthType != "open_router" {
+		if cfg.TopK > 0 {
+			return fmt.Errorf("topK is not supported by the %s API, use OpenRouter", provider.AuthType)
+		}
+		if cfg.ThinkingToken > 0 {
+			return fmt.Errorf("thinkingToken is not supported by the %s API, use OpenRouter", provider.AuthType)
+		}
+	}
+	if cfg.ThinkingToken > 0 && cfg.MaxTokens > 0 && cfg.ThinkingToken >= cfg.MaxTokens {
+		return fmt.Errorf("thinkingToken (%d) must be less than maxTokens (%d)", cfg.ThinkingToken, cfg.MaxTokens)
+	}
+	return nil
+}
+
+func validateAnthropicConfig(cfg database.AgentConfig) error {
+	if t := cfg.Temperature; t != nil && (*t < 0 || *t > 1) {
+		return fmt.Errorf("temperature must be between 0 and 1, got %g", *t)
+	}
+	if cfg.ThinkingToken == 0 {
+		// Temperature is only sent without extended thinking
+		if cfg.Temperature != nil && cfg.TopP > 0 {
+			if model, err := ResolveModel(cfg.Provider, cfg.ModelID); err == nil && model.ExclusiveSampling {
+				return fmt.Errorf("model %s does not accept both temperature and topP, set only one", cfg.ModelID)
+			}
+		}
+		return nil
+	}
+
+	maxTokens := cfg.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+	if cfg.ThinkingToken < minAnthropicThinkingTokens {
+		return fmt.Errorf("thinkingToken must be at least %d, got %d", minAnthropicThinkingTokens, cfg.ThinkingToken)
+	}
+	if cfg.ThinkingToken >= maxTokens {
+		return fmt.Errorf("thinkingToken (%d) must be less than maxTokens (%d)", cfg.ThinkingToken, maxTokens)
+	}
+	// Extended thinking is incompatible with a custom temperature and top_k
+	if t := cfg.Temperature; t != nil && *t != 1 {
+		return fmt.Errorf("temperature cannot be set with thinkingToken, got %g", *t)
+	}
+	if cfg.TopK > 0 {
+		return fmt.Errorf("topK cannot be set with thinkingToken")
+	}
+	if cfg.TopP > 0 && cfg.TopP < minAnthropicThinkingTopP {
+		return fmt.Errorf("topP must be at least %g with thinkingToken, got %g", minAnthropicThinkingTopP, cfg.TopP)
+	}
+	return nil
+}
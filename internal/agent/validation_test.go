@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"stockmind/internal/database"
+)
+
+func TestValidateAgentConfigSampling(t *testing.T) {
+	temperature := func(t float64) *float64 { return &t }
+	anthropicAgent := func(modelID string) database.AgentConfig {
+		return database.AgentConfig{Provider: database.ModelProviderAnthropic, ModelID: modelID}
+	}
+	providers := LLMProviderConfig{OpenAI: OpenAIConfig{AuthType: "open_router"}}
+
+	tests := []struct {
+		name    string
+		cfg     database.AgentConfig
+		edit    func(cfg *database.AgentConfig)
+		wantErr string
+	}{
+		{
+			name: "default sampling",
+			cfg:  anthropicAgent("CLAUDE_SONNET_4_5"),
+		},
+		{
+			name: "temperature of zero",
+			cfg:  anthropicAgent("CLAUDE_SONNET_4_5"),
+			edit: func(cfg *database.AgentConfig) { cfg.Temperature = temperature(0) },
+		},
+		{
+			name: "topP alone",
+			cfg:  anthropicAgent("CLAUDE_HAIKU_4_5"),
+			edit: func(cfg *database.AgentConfig) { cfg.TopP = 0.9 },
+		},
+		{
+			name:    "temperature and topP",
+			cfg:     anthropicAgent("CLAUDE_SONNET_4_5"),
+			edit:    func(cfg *database.AgentConfig) { cfg.Temperature, cfg.TopP = temperature(0.7), 0.9 },
+			wantErr: "does not accept both temperature and topP",
+		},
+		{
+			name:    "temperature of zero and topP",
+			cfg:     anthropicAgent("CLAUDE_OPUS_4_1"),
+			edit:    func(cfg *database.AgentConfig) { cfg.Temperature, cfg.TopP = temperature(0), 0.9 },
+			wantErr: "does not accept both temperature and topP",
+		},
+		{
+			name: "topP with thinking",
+			cfg:  anthropicAgent("CLAUDE_SONNET_4_5"),
+			edit: func(cfg *database.AgentConfig) {
+				cfg.Temperature, cfg.TopP, cfg.ThinkingToken = temperature(1), 0.95, 2048
+			},
+		},
+		{
+			name:    "temperature with thinking",
+			cfg:     anthropicAgent("CLAUDE_SONNET_4_5"),
+			edit:    func(cfg *database.AgentConfig) { cfg.Temperature, cfg.ThinkingToken = temperature(0), 2048 },
+			wantErr: "temperature cannot be set with thinkingToken",
+		},
+		{
+			name:    "anthropic temperature out of range",
+			cfg:     anthropicAgent("CLAUDE_SONNET_4_5"),
+			edit:    func(cfg *database.AgentConfig) { cfg.Temperature = temperature(1.5) },
+			wantErr: "temperature must be between 0 and 1",
+		},
+		{
+			name: "openai temperature and topP",
+			cfg:  database.AgentConfig{Provider: database.ModelProviderOpenAI, ModelID: "GLM_4_5_AIR"},
+			edit: func(cfg *database.AgentConfig) { cfg.Temperature, cfg.TopP = temperature(1.5), 0.9 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if tt.edit != nil {
+				tt.edit(&cfg)
+			}
+			err := validateAgentConfig(cfg, providers)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validateAgentConfig() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("validateAgentConfig() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"stockmind/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	pgvector "github.com/pgvector/pgvector-go"
+)
+
+// ScoredChunk is a document chunk returned by a search, with enough information to cite it
+type ScoredChunk struct {
+	ChunkID     uuid.UUID `json:"chunk_id"`
+	DocumentID  uuid.UUID `json:"document_id"`
+	Source      string    `json:"source"`
+	Title       string    `json:"title"`
+	PageNumber  int32     `json:"page_number"`
+	StartOffset int32     `json:"start_offset"`
+	EndOffset   int32     `json:"end_offset"`
+	Content     string    `json:"content"`
+	Score       float64   `json:"score"`
+}
+
+// VectorStore stores chunk embeddings in the pgvector backed chunk_embeddings table
+type VectorStore struct {
+	queries  *database.Queries
+	embedder Embedder
+}
+
+func NewVectorStore(queries *database.Queries, embedder Embedder) *VectorStore {
+	return &VectorStore{
+		queries:  queries,
+		embedder: embedder,
+	}
+}
+
+// WithTx returns a copy of the store running its queries in tx
+func (s *VectorStore) WithTx(tx pgx.Tx) *VectorStore {
+	return &VectorStore{
+		queries:  s.queries.WithTx(tx),
+		embedder: s.embedder,
+	}
+}
+
+// Upsert embeds the content of chunks and stores the embeddings, replacing existing ones
+func (s *VectorStore) Upsert(ctx context.Context, chunks []database.DocumentChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	texts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Content)
+	}
+	vectors, err := s.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	return s.Store(ctx, chunks, vectors)
+}
+
+// Embed embeds texts with the embedder of the store without storing anything, so callers can
+// compute embeddings before opening a transaction
+func (s *VectorStore) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return s.embedder.Embed(ctx, texts)
+}
+
+// Store stores the embeddings computed for chunks, vectors[i] being the embedding of chunks[i].
+// Existing embeddings are replaced.
+func (s *VectorStore) Store(ctx context.Context, chunks []database.DocumentChunk, vectors [][]float32) error {
+	if len(vectors) != len(chunks) {
+		return fmt.Errorf("got %d embeddings for %d chunks", len(vectors), len(chunks))
+	}
+	for i, chunk := range chunks {
+		err := s.queries.UpsertChunkEmbedding(ctx, database.UpsertChunkEmbeddingParams{
+			ChunkID:   chunk.ID,
+			Model:     s.embedder.Model(),
+			Embedding: pgvector.NewVector(vectors[i]),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upsert embedding of chunk %s: %w", chunk.ID, err)
+		}
+	}
+	return nil
+}
+
+// indexedEmbeddingDimensions is the dimension of the embeddings covered by the HNSW index of
+// chunk_embeddings, it must match the cast of the index
+const indexedEmbeddingDimensions = 1536
+
+// Search returns the k chunks of the knowledge base nearest to query by cosine similarity.
+// Embeddings of the indexed dimension are searched through the HNSW index, others by a scan.
+func (s *VectorStore) Search(ctx context.Context, knowledgeBaseID uuid.UUID, query string, k int) ([]ScoredChunk, error) {
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	params := database.SearchChunkEmbeddingsParams{
+		Embedding:       pgvector.NewVector(vectors[0]),
+		KnowledgeBaseID: knowledgeBaseID,
+		Model:           s.embedder.Model(),
+		TopK:            int32(k),
+	}
+	var rows []database.SearchChunkEmbeddingsRow
+	if len(vectors[0]) == indexedEmbeddingDimensions {
+		indexed, err := s.queries.SearchIndexedChunkEmbeddings(ctx, database.SearchIndexedChunkEmbeddingsParams(params))
+		if err != nil {
+			return nil, fmt.Errorf("failed to search chunk embeddings: %w", err)
+		}
+		for _, row := range indexed {
+			rows = append(rows, database.SearchChunkEmbeddingsRow(row))
+		}
+	} else {
+		rows, err = s.queries.SearchChunkEmbeddings(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search chunk embeddings: %w", err)
+		}
+	}
+	results := make([]ScoredChunk, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, ScoredChunk{
+			ChunkID:     row.ID,
+			DocumentID:  row.DocumentID,
+			Source:      row.Source,
+			Title:       row.Title,
+			PageNumber:  row.PageNumber,
+			StartOffset: row.StartOffset,
+			EndOffset:   row.EndOffset,
+			Content:     row.Content,
+			Score:       row.Score,
+		})
+	}
+	return results, nil
+}
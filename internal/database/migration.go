@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -10,8 +11,13 @@ import (
 )
 
 func MigrateDB(db *pgxpool.Pool) error {
+	return MigrateDBFS(db, os.DirFS("schema"))
+}
+
+// MigrateDBFS runs the migrations of the migrations directory of fsys
+func MigrateDBFS(db *pgxpool.Pool, fsys fs.FS) error {
 	// Set the base filesystem for goose migrations
-	goose.SetBaseFS(os.DirFS("schema"))
+	goose.SetBaseFS(fsys)
 
 	// Set the dialect to PostgreSQL
 	if err := goose.SetDialect("postgres"); err != nil {
@@ -7,6 +7,7 @@ package database
 import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
+	pgvector "github.com/pgvector/pgvector-go"
 )
 
 type AgentFlow struct {
@@ -17,6 +18,49 @@ type AgentFlow struct {
 	UpdatedAt pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
 }
 
+type ChunkEmbedding struct {
+	ChunkID   uuid.UUID          `db:"chunk_id" json:"chunk_id"`
+	Model     string             `db:"model" json:"model"`
+	Embedding pgvector.Vector    `db:"embedding" json:"embedding"`
+	CreatedAt pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
+type Document struct {
+	ID               uuid.UUID          `db:"id" json:"id"`
+	KnowledgeBaseID  uuid.UUID          `db:"knowledge_base_id" json:"knowledge_base_id"`
+	Source           string             `db:"source" json:"source"`
+	Title            string             `db:"title" json:"title"`
+	PageCount        int32              `db:"page_count" json:"page_count"`
+	ChunkingStrategy string             `db:"chunking_strategy" json:"chunking_strategy"`
+	ChunkSize        int32              `db:"chunk_size" json:"chunk_size"`
+	ChunkOverlap     int32              `db:"chunk_overlap" json:"chunk_overlap"`
+	CreatedAt        pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt        pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+	Path             string             `db:"path" json:"path"`
+	ContentHash      string             `db:"content_hash" json:"content_hash"`
+}
+
+type DocumentChunk struct {
+	ID          uuid.UUID          `db:"id" json:"id"`
+	DocumentID  uuid.UUID          `db:"document_id" json:"document_id"`
+	ChunkIndex  int32              `db:"chunk_index" json:"chunk_index"`
+	PageNumber  int32              `db:"page_number" json:"page_number"`
+	StartOffset int32              `db:"start_offset" json:"start_offset"`
+	EndOffset   int32              `db:"end_offset" json:"end_offset"`
+	Content     string             `db:"content" json:"content"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	ContentHash string             `db:"content_hash" json:"content_hash"`
+}
+
+type KnowledgeBase struct {
+	ID          uuid.UUID          `db:"id" json:"id"`
+	Name        string             `db:"name" json:"name"`
+	Description pgtype.Text        `db:"description" json:"description"`
+	CreatedAt   pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `db:"updated_at" json:"updated_at"`
+}
+
 type Session struct {
 	ID          uuid.UUID          `db:"id" json:"id"`
 	Title       string             `db:"title" json:"title"`
@@ -35,6 +79,7 @@ type SessionHistory struct {
 	Content    MessageUnion       `db:"content" json:"content"`
 	StopReason StopReason         `db:"stop_reason" json:"stop_reason"`
 	CreatedAt  pgtype.Timestamptz `db:"created_at" json:"created_at"`
+	Model      string             `db:"model" json:"model"`
 }
 
 type User struct {
@@ -73,7 +73,7 @@ func (q *Queries) GetSessionByID(ctx context.Context, id uuid.UUID) (Session, er
 }
 
 const getSessionHistoryBySessionID = `-- name: GetSessionHistoryBySessionID :many
-SELECT id, session_id, node, content, stop_reason, created_at FROM session_history WHERE session_id = $1 ORDER BY created_at ASC
+SELECT id, session_id, node, content, stop_reason, created_at, model FROM session_history WHERE session_id = $1 ORDER BY created_at ASC, id ASC
 `
 
 func (q *Queries) GetSessionHistoryBySessionID(ctx context.Context, sessionID uuid.UUID) ([]SessionHistory, error) {
@@ -92,6 +92,7 @@ func (q *Queries) GetSessionHistoryBySessionID(ctx context.Context, sessionID uu
 			&i.Content,
 			&i.StopReason,
 			&i.CreatedAt,
+			&i.Model,
 		); err != nil {
 			return nil, err
 		}
@@ -137,7 +138,7 @@ func (q *Queries) GetSessionsByUserID(ctx context.Context, createdBy uuid.UUID)
 }
 
 const sessionAddChatHistory = `-- name: SessionAddChatHistory :one
-INSERT INTO session_history (id, session_id, content, stop_reason, node) VALUES ($1, $2, $3, $4, $5) RETURNING id, session_id, node, content, stop_reason, created_at
+INSERT INTO session_history (id, session_id, content, stop_reason, node, model) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, session_id, node, content, stop_reason, created_at, model
 `
 
 type SessionAddChatHistoryParams struct {
@@ -146,6 +147,7 @@ type SessionAddChatHistoryParams struct {
 	Content    MessageUnion `db:"content" json:"content"`
 	StopReason StopReason   `db:"stop_reason" json:"stop_reason"`
 	Node       string       `db:"node" json:"node"`
+	Model      string       `db:"model" json:"model"`
 }
 
 func (q *Queries) SessionAddChatHistory(ctx context.Context, arg SessionAddChatHistoryParams) (SessionHistory, error) {
@@ -155,6 +157,7 @@ func (q *Queries) SessionAddChatHistory(ctx context.Context, arg SessionAddChatH
 		arg.Content,
 		arg.StopReason,
 		arg.Node,
+		arg.Model,
 	)
 	var i SessionHistory
 	err := row.Scan(
@@ -164,6 +167,7 @@ func (q *Queries) SessionAddChatHistory(ctx context.Context, arg SessionAddChatH
 		&i.Content,
 		&i.StopReason,
 		&i.CreatedAt,
+		&i.Model,
 	)
 	return i, err
 }
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/mark3labs/mcp-go/mcp"
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -17,6 +18,9 @@ const (
 	StopReasonNil        StopReason = ""
 )
 
+// DefaultKnowledgeBaseName is the knowledge base seeded by the migrations
+const DefaultKnowledgeBaseName = "default"
+
 type Node struct {
 	ID        string      `json:"id"`
 	Type      NodeType    `json:"type"` // start, agent
@@ -48,17 +52,62 @@ type NodeOutput struct {
 }
 
 type AgentConfig struct {
-	Description   string        `json:"description"`
-	SystemPrompt  string        `json:"systemPrompt"`
-	Provider      ModelProvider `json:"provider"` // anthropic or openai
-	ModelID       string        `json:"modelId"`
-	MaxTokens     int64         `json:"maxTokens"`
-	Temperature   float64       `json:"temperature"`
-	TopP          float64       `json:"topP"`
-	TopK          int64         `json:"topK"`
-	ThinkingToken int64         `json:"thinkingToken"`
-	Tools         []mcp.Tool    `json:"tools"`
-	McpServers    []MCPConfig   `json:"mcpServers"` // MCP servers to use
+	Description     string           `json:"description"`
+	SystemPrompt    string           `json:"systemPrompt"`
+	Provider        ModelProvider    `json:"provider"` // anthropic or openai
+	ModelID         string           `json:"modelId"`
+	MaxTokens       int64            `json:"maxTokens"`
+	Temperature     *float64         `json:"temperature,omitempty"` // Sampling temperature, the provider default when unset
+	TopP            float64          `json:"topP"`
+	TopK            int64            `json:"topK"`
+	ThinkingToken   int64            `json:"thinkingToken"`
+	Tools           []mcp.Tool       `json:"tools"`
+	McpServers      []MCPConfig      `json:"mcpServers"`                // MCP servers to use
+	AllowedTools    []string         `json:"allowedTools,omitempty"`    // Glob patterns of the tools exposed to the model, all tools when empty
+	DeniedTools     []string         `json:"deniedTools,omitempty"`     // Glob patterns of the tools hidden from the model
+	ToolConcurrency int64            `json:"toolConcurrency,omitempty"` // Tool calls of one turn run at the same time, 4 when unset
+	ToolTimeout     int64            `json:"toolTimeout,omitempty"`     // Timeout of one tool call in seconds, 60 when unset
+	MaxToolFailures int64            `json:"maxToolFailures,omitempty"` // Consecutive failed tool calls ending the turn, 3 when unset
+	Fallbacks       []ModelFallback  `json:"fallbacks,omitempty"`       // Models tried in order when the agent model keeps failing
+	Retry           *RetryPolicy     `json:"retry,omitempty"`           // Retry policy of every model, default policy when nil
+	Retrieval       *RetrievalConfig `json:"retrieval,omitempty"`       // Knowledge base retrieval, disabled when nil
+}
+
+type ModelFallback struct {
+	Provider ModelProvider `json:"provider,omitempty"` // anthropic or openai, the agent provider when empty
+	ModelID  string        `json:"modelId"`
+}
+
+type RetryPolicy struct {
+	MaxAttempts          int64 `json:"maxAttempts,omitempty"`          // Attempts per model, 3 when unset
+	InitialBackoff       int64 `json:"initialBackoff,omitempty"`       // Delay before the first retry in milliseconds, 500 when unset
+	MaxBackoff           int64 `json:"maxBackoff,omitempty"`           // Upper bound of the delay in milliseconds, 8000 when unset
+	RetryableStatusCodes []int `json:"retryableStatusCodes,omitempty"` // HTTP status codes worth retrying, 408, 409, 429, 500, 502, 503, 504 and 529 when empty
+}
+
+type RetrievalMode string
+
+const (
+	RetrievalModeVector  RetrievalMode = "vector"  // Embedding similarity only
+	RetrievalModeLexical RetrievalMode = "lexical" // Postgres full-text search only
+	RetrievalModeHybrid  RetrievalMode = "hybrid"  // Both, merged with reciprocal rank fusion
+)
+
+type RerankerType string
+
+const (
+	RerankerLLM     RerankerType = "llm"     // LLM as a judge scoring every candidate against the query
+	RerankerLexical RerankerType = "lexical" // Query term overlap, needs no model
+)
+
+type RetrievalConfig struct {
+	KnowledgeBase string        `json:"knowledgeBase"`         // Knowledge base name, default knowledge base when empty
+	Mode          RetrievalMode `json:"mode,omitempty"`        // Search mode, hybrid when empty
+	TopK          int64         `json:"topK"`                  // Number of chunks injected in the system prompt
+	MinScore      float64       `json:"minScore"`              // Minimum cosine similarity of a chunk found by vector search
+	Reranker      RerankerType  `json:"reranker,omitempty"`    // Reranks the candidates before keeping topK, disabled when empty
+	RerankModel   string        `json:"rerankModel,omitempty"` // Model of the llm reranker, the agent model when empty
+	Candidates    int64         `json:"candidates,omitempty"`  // Number of candidates retrieved for reranking
 }
 
 type MCPConfig struct {
@@ -77,6 +126,6 @@ type AgentFlowConfig struct {
 }
 
 type MessageUnion struct {
-	OfOpenAI *openai.ChatCompletionMessage `json:"of_openai,omitempty"`
-	// OfAnthropic *anthropic.MessageParam `json:"of_anthropic,omitempty"`
+	OfOpenAI    *openai.ChatCompletionMessage `json:"of_openai,omitempty"`
+	OfAnthropic *anthropic.MessageParam       `json:"of_anthropic,omitempty"`
 }
@@ -0,0 +1,266 @@
+package evaluation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"stockmind/internal/agent"
+	"stockmind/internal/database"
+	"stockmind/internal/knowledge"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gopkg.in/yaml.v3"
+)
+
+// KnowledgeBasePrefix prefixes the knowledge bases the documents are ingested into, one per
+// configuration. They are kept between runs so unchanged documents are not chunked and embedded again.
+const KnowledgeBasePrefix = "eval_"
+
+// EmbedderNone stores chunks without embeddings, only lexical retrieval is then available
+const EmbedderNone = "none"
+
+// Config is a chunking, embedding and retrieval configuration to evaluate
+type Config struct {
+	Name      string                 `json:"name" yaml:"name"`
+	Strategy  agent.ChunkingStrategy `json:"strategy" yaml:"strategy"`
+	ChunkSize int                    `json:"chunk_size" yaml:"chunk_size"`
+	Overlap   int                    `json:"overlap" yaml:"overlap"`
+	// Embedder is the embedding provider (openai, hash or none)
+	Embedder string                 `json:"embedder" yaml:"embedder"`
+	Mode     database.RetrievalMode `json:"mode" yaml:"mode"`
+}
+
+// KnowledgeBase returns the name of the knowledge base holding the documents chunked with c
+func (c Config) KnowledgeBase() string {
+	return KnowledgeBasePrefix + c.Name
+}
+
+func (c Config) validate() error {
+	if c.Name == "" || strings.ContainsAny(c.Name, `/\`) {
+		return fmt.Errorf("invalid configuration name %q", c.Name)
+	}
+	if c.Strategy == "" || !c.Strategy.Valid() {
+		return fmt.Errorf("configuration %s: unsupported chunking strategy %q", c.Name, c.Strategy)
+	}
+	if c.Strategy == agent.ChunkingStrategyAgentic {
+		return fmt.Errorf("configuration %s: the agentic strategy cannot be evaluated", c.Name)
+	}
+	if _, err := agent.NewChunking(c.ChunkSize, c.Overlap); err != nil {
+		return fmt.Errorf("configuration %s: %w", c.Name, err)
+	}
+	switch c.Mode {
+	case database.RetrievalModeVector:
+		if c.Embedder == EmbedderNone {
+			return fmt.Errorf("configuration %s: vector retrieval requires an embedder", c.Name)
+		}
+	case database.RetrievalModeLexical, database.RetrievalModeHybrid:
+	default:
+		return fmt.Errorf("configuration %s: unsupported retrieval mode %q", c.Name, c.Mode)
+	}
+	return nil
+}
+
+// DefaultConfigs compares fixed size chunking by words with recursive chunking, both embedded
+// with the configured embedding provider and retrieved with hybrid search
+func DefaultConfigs() []Config {
+	return []Config{
+		{
+			Name:      "fixed_size_by_word",
+			Strategy:  agent.ChunkingStrategyFixedSizeByWord,
+			ChunkSize: 200,
+			Overlap:   20,
+			Embedder:  agent.EmbeddingProvider.Provider,
+			Mode:      database.RetrievalModeHybrid,
+		},
+		{
+			Name:      "recursive",
+			Strategy:  agent.ChunkingStrategyRecursive,
+			ChunkSize: 1000,
+			Overlap:   100,
+			Embedder:  agent.EmbeddingProvider.Provider,
+			Mode:      database.RetrievalModeHybrid,
+		},
+	}
+}
+
+// LoadConfigs reads the configurations listed under the configs key of a YAML or JSON file.
+// The embedder defaults to the configured embedding provider and the mode to hybrid.
+func LoadConfigs(path string) ([]Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configurations %s: %w", path, err)
+	}
+	var file struct {
+		Configs []Config `yaml:"configs"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse configurations %s: %w", path, err)
+	}
+	if len(file.Configs) == 0 {
+		return nil, fmt.Errorf("configurations file %s has no configs", path)
+	}
+	for i := range file.Configs {
+		if file.Configs[i].Embedder == "" {
+			file.Configs[i].Embedder = agent.EmbeddingProvider.Provider
+		}
+		if file.Configs[i].Mode == "" {
+			file.Configs[i].Mode = database.RetrievalModeHybrid
+		}
+	}
+	return file.Configs, nil
+}
+
+// Evaluator ingests a directory of documents under every configuration and scores the
+// retrieval of a golden set against it
+type Evaluator struct {
+	db  *pgxpool.Pool
+	dir string
+	k   int
+}
+
+func NewEvaluator(dbPool *pgxpool.Pool, dir string, k int) (*Evaluator, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", k)
+	}
+	return &Evaluator{
+		db:  dbPool,
+		dir: dir,
+		k:   k,
+	}, nil
+}
+
+// Report holds the metrics of every configuration, averaged over the golden set
+type Report struct {
+	K         int            `json:"k"`
+	Questions int            `json:"questions"`
+	Results   []ConfigResult `json:"results"`
+}
+
+type ConfigResult struct {
+	Config        Config `json:"config"`
+	KnowledgeBase string `json:"knowledge_base"`
+	Metrics
+	Questions []QuestionResult `json:"questions"`
+}
+
+type QuestionResult struct {
+	ID       string `json:"id"`
+	Question string `json:"question"`
+	Metrics
+	Retrieved []RetrievedChunk `json:"retrieved"`
+}
+
+// RetrievedChunk locates a retrieved chunk without its content, which keeps reports readable
+type RetrievedChunk struct {
+	Source      string  `json:"source"`
+	PageNumber  int32   `json:"page_number"`
+	StartOffset int32   `json:"start_offset"`
+	EndOffset   int32   `json:"end_offset"`
+	Score       float64 `json:"score"`
+	Relevant    bool    `json:"relevant"`
+}
+
+// Run evaluates every configuration in order. Configuration names must be unique because
+// each one is ingested into its own knowledge base.
+func (e *Evaluator) Run(ctx context.Context, questions []Question, configs []Config) (Report, error) {
+	report := Report{
+		K:         e.k,
+		Questions: len(questions),
+	}
+	names := make(map[string]bool)
+	for _, cfg := range configs {
+		if err := cfg.validate(); err != nil {
+			return report, err
+		}
+		if names[cfg.Name] {
+			return report, fmt.Errorf("duplicate configuration name %s", cfg.Name)
+		}
+		names[cfg.Name] = true
+	}
+
+	for _, cfg := range configs {
+		result, err := e.evaluate(ctx, questions, cfg)
+		if err != nil {
+			return report, fmt.Errorf("failed to evaluate configuration %s: %w", cfg.Name, err)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func (e *Evaluator) evaluate(ctx context.Context, questions []Question, cfg Config) (ConfigResult, error) {
+	result := ConfigResult{
+		Config:        cfg,
+		KnowledgeBase: cfg.KnowledgeBase(),
+	}
+
+	var embedder agent.Embedder
+	if cfg.Embedder != EmbedderNone {
+		config := agent.EmbeddingProvider
+		config.Provider = cfg.Embedder
+		var err error
+		embedder, err = agent.NewEmbedder(config)
+		if err != nil {
+			return result, fmt.Errorf("failed to create embedder: %w", err)
+		}
+	}
+
+	service := knowledge.NewService(e.db, embedder)
+	err := service.IngestDir(ctx, e.dir, knowledge.IngestOptions{
+		KnowledgeBase: result.KnowledgeBase,
+		Strategy:      cfg.Strategy,
+		ChunkSize:     cfg.ChunkSize,
+		Overlap:       cfg.Overlap,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	queries := database.New(e.db)
+	var store *agent.VectorStore
+	if embedder != nil {
+		store = agent.NewVectorStore(queries, embedder)
+	}
+	searcher := agent.NewKnowledgeSearcher(queries, store)
+	retrieval := database.RetrievalConfig{
+		KnowledgeBase: result.KnowledgeBase,
+		Mode:          cfg.Mode,
+		TopK:          int64(e.k),
+	}
+
+	metrics := make([]Metrics, 0, len(questions))
+	for _, q := range questions {
+		chunks, err := searcher.Search(ctx, retrieval, q.Question)
+		if err != nil {
+			return result, fmt.Errorf("failed to search question %s: %w", q.ID, err)
+		}
+		m := Score(chunks, q.Expected, e.k)
+		metrics = append(metrics, m)
+
+		qr := QuestionResult{
+			ID:        q.ID,
+			Question:  q.Question,
+			Metrics:   m,
+			Retrieved: make([]RetrievedChunk, 0, len(chunks)),
+		}
+		for _, chunk := range chunks {
+			relevant := false
+			for _, passage := range q.Expected {
+				relevant = relevant || matches(chunk, passage)
+			}
+			qr.Retrieved = append(qr.Retrieved, RetrievedChunk{
+				Source:      chunk.Source,
+				PageNumber:  chunk.PageNumber,
+				StartOffset: chunk.StartOffset,
+				EndOffset:   chunk.EndOffset,
+				Score:       chunk.Score,
+				Relevant:    relevant,
+			})
+		}
+		result.Questions = append(result.Questions, qr)
+	}
+	result.Metrics = meanMetrics(metrics)
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package evaluation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Passage is a source passage a question is expected to retrieve. A passage without text
+// matches any chunk of its source document.
+type Passage struct {
+	// Source is the file name of the document, empty to match any document
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	Text   string `json:"text,omitempty" yaml:"text,omitempty"`
+}
+
+// Question is a golden question with the passages that answer it
+type Question struct {
+	ID       string    `json:"id" yaml:"id"`
+	Question string    `json:"question" yaml:"question"`
+	Expected []Passage `json:"expected" yaml:"expected"`
+}
+
+// LoadGoldenSet reads the questions of a golden set. YAML files hold a list of questions
+// under the questions key, JSONL files hold one question per line.
+func LoadGoldenSet(path string) ([]Question, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden set %s: %w", path, err)
+	}
+
+	var questions []Question
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var set struct {
+			Questions []Question `yaml:"questions"`
+		}
+		if err := yaml.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("failed to parse golden set %s: %w", path, err)
+		}
+		questions = set.Questions
+	case ".jsonl":
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var q Question
+			if err := json.Unmarshal([]byte(text), &q); err != nil {
+				return nil, fmt.Errorf("failed to parse line %d of golden set %s: %w", line, path, err)
+			}
+			questions = append(questions, q)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read golden set %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported golden set format %s, use .yaml, .yml or .jsonl", path)
+	}
+
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("golden set %s has no questions", path)
+	}
+	for i := range questions {
+		q := &questions[i]
+		if q.ID == "" {
+			q.ID = fmt.Sprintf("q%d", i+1)
+		}
+		if strings.TrimSpace(q.Question) == "" {
+			return nil, fmt.Errorf("question %s of golden set %s has no question text", q.ID, path)
+		}
+		if len(q.Expected) == 0 {
+			return nil, fmt.Errorf("question %s of golden set %s has no expected passages", q.ID, path)
+		}
+		for _, p := range q.Expected {
+			if p.Source == "" && strings.TrimSpace(p.Text) == "" {
+				return nil, fmt.Errorf("question %s of golden set %s has an expected passage without source or text", q.ID, path)
+			}
+		}
+	}
+	return questions, nil
+}
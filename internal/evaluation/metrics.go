@@ -0,0 +1,116 @@
+package evaluation
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"stockmind/internal/agent"
+)
+
+// MinPassageCoverage is the share of the words of an expected passage a chunk must contain to
+// match it. Chunk boundaries rarely line up with the passage, so a chunk holding most of it counts.
+const MinPassageCoverage = 0.5
+
+// Metrics are the retrieval metrics of one question, or their mean over a golden set
+type Metrics struct {
+	// Recall is the share of the expected passages found in the top k chunks
+	Recall float64 `json:"recall"`
+	// MRR is the reciprocal rank of the first relevant chunk
+	MRR float64 `json:"mrr"`
+	// NDCG is the normalized discounted cumulative gain with binary relevance
+	NDCG float64 `json:"ndcg"`
+}
+
+// Score computes the metrics of the top k retrieved chunks against the expected passages. Every
+// passage is credited once, to the first chunk matching it, so duplicate chunks do not inflate the gain.
+func Score(chunks []agent.ScoredChunk, expected []Passage, k int) Metrics {
+	if len(expected) == 0 || k <= 0 {
+		return Metrics{}
+	}
+	chunks = chunks[:min(k, len(chunks))]
+
+	found := make([]bool, len(expected))
+	var m Metrics
+	var dcg float64
+	for rank, chunk := range chunks {
+		relevant := false
+		gain := 0.0
+		for i, passage := range expected {
+			if !matches(chunk, passage) {
+				continue
+			}
+			relevant = true
+			if !found[i] {
+				found[i] = true
+				gain = 1
+			}
+		}
+		if relevant && m.MRR == 0 {
+			m.MRR = 1 / float64(rank+1)
+		}
+		dcg += gain / math.Log2(float64(rank+2))
+	}
+
+	hits := 0
+	for _, f := range found {
+		if f {
+			hits++
+		}
+	}
+	m.Recall = float64(hits) / float64(len(expected))
+
+	var idcg float64
+	for rank := range min(len(expected), k) {
+		idcg += 1 / math.Log2(float64(rank+2))
+	}
+	m.NDCG = dcg / idcg
+	return m
+}
+
+// meanMetrics averages the metrics of every question
+func meanMetrics(metrics []Metrics) Metrics {
+	var mean Metrics
+	if len(metrics) == 0 {
+		return mean
+	}
+	for _, m := range metrics {
+		mean.Recall += m.Recall
+		mean.MRR += m.MRR
+		mean.NDCG += m.NDCG
+	}
+	n := float64(len(metrics))
+	mean.Recall /= n
+	mean.MRR /= n
+	mean.NDCG /= n
+	return mean
+}
+
+// matches reports whether chunk comes from the source of passage and contains enough of its text
+func matches(chunk agent.ScoredChunk, passage Passage) bool {
+	if passage.Source != "" && !strings.EqualFold(chunk.Source, passage.Source) {
+		return false
+	}
+	want := words(passage.Text)
+	if len(want) == 0 {
+		return true
+	}
+	have := make(map[string]bool)
+	for _, w := range words(chunk.Content) {
+		have[w] = true
+	}
+	covered := 0
+	for _, w := range want {
+		if have[w] {
+			covered++
+		}
+	}
+	return float64(covered)/float64(len(want)) >= MinPassageCoverage
+}
+
+// words returns the lower-cased words of text, ignoring punctuation
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,161 @@
+package evaluation
+
+import (
+	"math"
+	"testing"
+
+	"stockmind/internal/agent"
+)
+
+func scoredChunk(source, content string) agent.ScoredChunk {
+	return agent.ScoredChunk{Source: source, Content: content}
+}
+
+func TestScore(t *testing.T) {
+	alpha := Passage{Source: "report.pdf", Text: "Alpha beta gamma."}
+	delta := Passage{Source: "report.pdf", Text: "delta epsilon zeta"}
+	eta := Passage{Text: "eta theta iota"}
+	alphaChunk := scoredChunk("report.pdf", "Intro. alpha, beta and gamma!")
+	deltaChunk := scoredChunk("Report.PDF", "delta epsilon zeta")
+	etaChunk := scoredChunk("notes.md", "eta theta iota kappa")
+	other := scoredChunk("report.pdf", "unrelated words")
+
+	tests := []struct {
+		name     string
+		chunks   []agent.ScoredChunk
+		expected []Passage
+		k        int
+		want     Metrics
+	}{
+		{
+			name:     "perfect ranking",
+			chunks:   []agent.ScoredChunk{alphaChunk, deltaChunk},
+			expected: []Passage{alpha, delta},
+			k:        2,
+			want:     Metrics{Recall: 1, MRR: 1, NDCG: 1},
+		},
+		{
+			name:     "first relevant chunk at rank 2",
+			chunks:   []agent.ScoredChunk{other, alphaChunk},
+			expected: []Passage{alpha},
+			k:        2,
+			want:     Metrics{Recall: 1, MRR: 0.5, NDCG: 1 / math.Log2(3)},
+		},
+		{
+			name:     "relevant chunk below k",
+			chunks:   []agent.ScoredChunk{other, alphaChunk},
+			expected: []Passage{alpha},
+			k:        1,
+			want:     Metrics{},
+		},
+		{
+			name:     "no relevant chunk",
+			chunks:   []agent.ScoredChunk{other, etaChunk},
+			expected: []Passage{alpha, delta},
+			k:        5,
+			want:     Metrics{},
+		},
+		{
+			name:     "duplicate chunks are credited once",
+			chunks:   []agent.ScoredChunk{alphaChunk, alphaChunk, deltaChunk},
+			expected: []Passage{alpha, delta},
+			k:        3,
+			want: Metrics{
+				Recall: 1,
+				MRR:    1,
+				NDCG:   (1 + 1/math.Log2(4)) / (1 + 1/math.Log2(3)),
+			},
+		},
+		{
+			name:     "more expected passages than k",
+			chunks:   []agent.ScoredChunk{alphaChunk, deltaChunk, etaChunk},
+			expected: []Passage{alpha, delta, eta},
+			k:        2,
+			// The ideal ranking only has k relevant chunks, so a full top k is a perfect nDCG
+			want: Metrics{Recall: 2.0 / 3, MRR: 1, NDCG: 1},
+		},
+		{
+			name:     "passage without source matches any source",
+			chunks:   []agent.ScoredChunk{etaChunk},
+			expected: []Passage{eta},
+			k:        1,
+			want:     Metrics{Recall: 1, MRR: 1, NDCG: 1},
+		},
+		{
+			name:     "chunk of another source does not match",
+			chunks:   []agent.ScoredChunk{scoredChunk("other.pdf", "alpha beta gamma")},
+			expected: []Passage{alpha},
+			k:        1,
+			want:     Metrics{},
+		},
+		{
+			name:     "chunk covering half of the passage matches",
+			chunks:   []agent.ScoredChunk{scoredChunk("report.pdf", "the alpha and the beta")},
+			expected: []Passage{alpha},
+			k:        1,
+			want:     Metrics{Recall: 1, MRR: 1, NDCG: 1},
+		},
+		{
+			name:     "chunk covering less than half of the passage does not match",
+			chunks:   []agent.ScoredChunk{scoredChunk("report.pdf", "only alpha")},
+			expected: []Passage{alpha},
+			k:        1,
+			want:     Metrics{},
+		},
+		{
+			name:     "chunk matching two passages gains once",
+			chunks:   []agent.ScoredChunk{scoredChunk("report.pdf", "alpha beta gamma delta epsilon zeta")},
+			expected: []Passage{alpha, delta},
+			k:        2,
+			want:     Metrics{Recall: 1, MRR: 1, NDCG: 1 / (1 + 1/math.Log2(3))},
+		},
+		{
+			name:     "fewer chunks than k",
+			chunks:   []agent.ScoredChunk{alphaChunk},
+			expected: []Passage{alpha, delta},
+			k:        10,
+			want:     Metrics{Recall: 0.5, MRR: 1, NDCG: 1 / (1 + 1/math.Log2(3))},
+		},
+		{
+			name:   "no expected passages",
+			chunks: []agent.ScoredChunk{alphaChunk},
+			k:      1,
+			want:   Metrics{},
+		},
+		{
+			name:     "k of zero",
+			chunks:   []agent.ScoredChunk{alphaChunk},
+			expected: []Passage{alpha},
+			want:     Metrics{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(tt.chunks, tt.expected, tt.k)
+			if !metricsEqual(got, tt.want) {
+				t.Errorf("Score() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeanMetrics(t *testing.T) {
+	got := meanMetrics([]Metrics{
+		{Recall: 1, MRR: 1, NDCG: 1},
+		{Recall: 0.5, MRR: 0, NDCG: 0.25},
+	})
+	want := Metrics{Recall: 0.75, MRR: 0.5, NDCG: 0.625}
+	if !metricsEqual(got, want) {
+		t.Errorf("meanMetrics() = %+v, want %+v", got, want)
+	}
+	if got := meanMetrics(nil); got != (Metrics{}) {
+		t.Errorf("meanMetrics(nil) = %+v, want zero metrics", got)
+	}
+}
+
+func metricsEqual(a, b Metrics) bool {
+	const epsilon = 1e-9
+	return math.Abs(a.Recall-b.Recall) < epsilon &&
+		math.Abs(a.MRR-b.MRR) < epsilon &&
+		math.Abs(a.NDCG-b.NDCG) < epsilon
+}
@@ -0,0 +1,28 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteTable writes one row of averaged metrics per configuration
+func (r Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "CONFIG\tSTRATEGY\tSIZE\tOVERLAP\tEMBEDDER\tMODE\tRECALL@%d\tMRR\tNDCG@%d\n", r.K, r.K)
+	for _, result := range r.Results {
+		cfg := result.Config
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%.3f\t%.3f\t%.3f\n",
+			cfg.Name, cfg.Strategy, cfg.ChunkSize, cfg.Overlap, cfg.Embedder, cfg.Mode,
+			result.Recall, result.MRR, result.NDCG)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report with the metrics and retrieved chunks of every question
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
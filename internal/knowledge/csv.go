@@ -0,0 +1,42 @@
+package knowledge
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CSVLoader renders a CSV export as a Markdown table whose header is the first record, so the
+// structural chunking strategy can split it between rows and repeat the header
+type CSVLoader struct{}
+
+func (CSVLoader) Load(path string) (Content, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to read csv %s: %w", path, err)
+	}
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\uFEFF")
+	}
+
+	var sb strings.Builder
+	writeMarkdownTable(&sb, records)
+	text := normalizeText(sb.String())
+	if text == "" {
+		return Content{Structured: true}, nil
+	}
+	return Content{
+		Pages:      []Page{{Number: 1, Text: text}},
+		Structured: true,
+	}, nil
+}
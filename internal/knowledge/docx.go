@@ -0,0 +1,250 @@
+package knowledge
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DOCXLoader reads the body of a Word document. Paragraphs styled as headings become Markdown
+// headings, numbered or bulleted paragraphs become list items and tables become Markdown tables.
+type DOCXLoader struct{}
+
+// wordNamespace is the namespace of the WordprocessingML elements of document.xml
+const wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+func (DOCXLoader) Load(path string) (Content, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to open docx %s: %w", path, err)
+	}
+	defer r.Close()
+
+	var content Content
+	content.Structured = true
+	for _, f := range r.File {
+		switch f.Name {
+		case "word/document.xml":
+			text, err := readZipFile(f, parseDOCXBody)
+			if err != nil {
+				return Content{}, fmt.Errorf("failed to read docx %s: %w", path, err)
+			}
+			if text = normalizeText(text); text != "" {
+				content.Pages = []Page{{Number: 1, Text: text}}
+			}
+		case "docProps/core.xml":
+			// The title is optional metadata, a broken core.xml does not make the document unreadable
+			content.Title, _ = readZipFile(f, parseDOCXTitle)
+		}
+	}
+	return content, nil
+}
+
+// maxDOCXPartSize bounds the decompressed size of a part of a docx, so a small upload cannot
+// inflate to gigabytes (a zip bomb)
+const maxDOCXPartSize = 128 << 20
+
+// readZipFile parses a part of the archive, failing when it decompresses to more than
+// maxDOCXPartSize bytes whatever size the archive declares
+func readZipFile(f *zip.File, parse func(io.Reader) (string, error)) (string, error) {
+	if f.UncompressedSize64 > maxDOCXPartSize {
+		return "", fmt.Errorf("%s is larger than %d bytes", f.Name, maxDOCXPartSize)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	limited := &io.LimitedReader{R: rc, N: maxDOCXPartSize + 1}
+	text, err := parse(limited)
+	if limited.N <= 0 {
+		return "", fmt.Errorf("%s is larger than %d bytes", f.Name, maxDOCXPartSize)
+	}
+	return text, err
+}
+
+// docxParagraph accumulates the runs of a w:p element
+type docxParagraph struct {
+	text         strings.Builder
+	headingLevel int
+	listLevel    int
+	isList       bool
+}
+
+func (p *docxParagraph) markdown() string {
+	text := strings.TrimSpace(p.text.String())
+	switch {
+	case text == "":
+		return ""
+	case p.headingLevel > 0:
+		return strings.Repeat("#", min(p.headingLevel, 6)) + " " + text
+	case p.isList:
+		return strings.Repeat("  ", p.listLevel) + "- " + text
+	default:
+		return text
+	}
+}
+
+// parseDOCXBody converts word/document.xml to Markdown
+func parseDOCXBody(r io.Reader) (string, error) {
+	var sb strings.Builder
+	var para *docxParagraph
+	// Tables may be nested, each level collects its rows of cells
+	var tables [][][]string
+	var prevList bool
+
+	writeBlock := func(block string, isList bool) {
+		if block == "" {
+			return
+		}
+		// Consecutive list items form one list, other blocks are separated by a blank line
+		if sb.Len() > 0 {
+			if isList && prevList {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString("\n\n")
+			}
+		}
+		sb.WriteString(block)
+		prevList = isList
+	}
+
+	decoder := xml.NewDecoder(r)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				para = &docxParagraph{}
+			case "pStyle":
+				if para != nil {
+					para.headingLevel = docxHeadingLevel(docxAttr(t, "val"))
+				}
+			case "numPr":
+				if para != nil {
+					para.isList = true
+				}
+			case "ilvl":
+				if para != nil {
+					para.listLevel, _ = strconv.Atoi(docxAttr(t, "val"))
+				}
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return "", err
+				}
+				if para != nil {
+					para.text.WriteString(text)
+				}
+			case "tab":
+				if para != nil {
+					para.text.WriteString("\t")
+				}
+			case "br", "cr":
+				if para != nil {
+					para.text.WriteString(" ")
+				}
+			case "tbl":
+				tables = append(tables, nil)
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1] = append(tables[len(tables)-1], nil)
+				}
+			case "tc":
+				if n := len(tables); n > 0 && len(tables[n-1]) > 0 {
+					rows := tables[n-1]
+					rows[len(rows)-1] = append(rows[len(rows)-1], "")
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordNamespace {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				if para == nil {
+					continue
+				}
+				if n := len(tables); n > 0 && len(tables[n-1]) > 0 {
+					// Paragraphs of a table cell are joined into the cell text
+					rows := tables[n-1]
+					row := rows[len(rows)-1]
+					if len(row) > 0 {
+						row[len(row)-1] = strings.TrimSpace(row[len(row)-1] + " " + para.text.String())
+					}
+				} else {
+					writeBlock(para.markdown(), para.isList && para.headingLevel == 0)
+				}
+				para = nil
+			case "tbl":
+				rows := tables[len(tables)-1]
+				tables = tables[:len(tables)-1]
+				if len(tables) > 0 {
+					// A nested table is flattened into the text of the enclosing cell
+					var cells []string
+					for _, row := range rows {
+						cells = append(cells, strings.Join(row, " "))
+					}
+					if outer := tables[len(tables)-1]; len(outer) > 0 {
+						row := outer[len(outer)-1]
+						if len(row) > 0 {
+							row[len(row)-1] = strings.TrimSpace(row[len(row)-1] + " " + strings.Join(cells, " "))
+						}
+					}
+					continue
+				}
+				var table strings.Builder
+				writeMarkdownTable(&table, rows)
+				writeBlock(strings.TrimSpace(table.String()), false)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// docxHeadingLevel returns the heading level of a paragraph style such as Heading1 or Title, 0 otherwise
+func docxHeadingLevel(style string) int {
+	style = strings.ToLower(strings.ReplaceAll(style, " ", ""))
+	if style == "title" {
+		return 1
+	}
+	if level, ok := strings.CutPrefix(style, "heading"); ok {
+		if n, err := strconv.Atoi(level); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func docxAttr(t xml.StartElement, name string) string {
+	for _, attr := range t.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// parseDOCXTitle reads dc:title from docProps/core.xml
+func parseDOCXTitle(r io.Reader) (string, error) {
+	var core struct {
+		Title string `xml:"http://purl.org/dc/elements/1.1/ title"`
+	}
+	if err := xml.NewDecoder(r).Decode(&core); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(core.Title), nil
+}
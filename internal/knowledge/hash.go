@@ -0,0 +1,108 @@
+package knowledge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	"stockmind/internal/agent"
+	"stockmind/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// contentHash returns the hex encoded SHA-256 of text
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// documentHash hashes the title and the numbered pages of a document, so a document whose
+// content did not change can be skipped without chunking it again
+func documentHash(title string, pages []Page) string {
+	h := sha256.New()
+	h.Write([]byte(title))
+	for _, page := range pages {
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.Itoa(page.Number)))
+		h.Write([]byte{0})
+		h.Write([]byte(page.Text))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// pageChunk is a chunk of a page with its position in the document
+type pageChunk struct {
+	Index      int
+	PageNumber int
+	Chunk      agent.Chunk
+	Hash       string
+}
+
+// chunkMatch pairs a new chunk with the stored row it replaces
+type chunkMatch struct {
+	Chunk pageChunk
+	Row   database.ListDocumentChunkHashesRow
+}
+
+// moved reports whether the chunk sits at another position than the stored row
+func (m chunkMatch) moved() bool {
+	return m.Row.ChunkIndex != int32(m.Chunk.Index) ||
+		m.Row.PageNumber != int32(m.Chunk.PageNumber) ||
+		m.Row.StartOffset != int32(m.Chunk.Chunk.Start) ||
+		m.Row.EndOffset != int32(m.Chunk.Chunk.End)
+}
+
+// chunkPlan is the set of changes that turns the stored chunks of a document into the new ones
+type chunkPlan struct {
+	// Unchanged chunks keep their row and embedding, only their position may be updated
+	Unchanged []chunkMatch
+	// Updated chunks reuse a stored row whose content changed, they are embedded again
+	Updated []chunkMatch
+	Added   []pageChunk
+	Removed []uuid.UUID
+}
+
+// planChunks matches the new chunks to the stored ones by content hash. Chunks without a match
+// take over the leftover rows in document order, the rows still left over are removed.
+func planChunks(stored []database.ListDocumentChunkHashesRow, chunks []pageChunk) chunkPlan {
+	byHash := make(map[string][]database.ListDocumentChunkHashesRow)
+	for _, row := range stored {
+		if row.ContentHash != "" {
+			byHash[row.ContentHash] = append(byHash[row.ContentHash], row)
+		}
+	}
+
+	var plan chunkPlan
+	used := make(map[uuid.UUID]bool)
+	var unmatched []pageChunk
+	for _, chunk := range chunks {
+		rows := byHash[chunk.Hash]
+		if len(rows) == 0 {
+			unmatched = append(unmatched, chunk)
+			continue
+		}
+		byHash[chunk.Hash] = rows[1:]
+		used[rows[0].ID] = true
+		plan.Unchanged = append(plan.Unchanged, chunkMatch{Chunk: chunk, Row: rows[0]})
+	}
+
+	var leftover []database.ListDocumentChunkHashesRow
+	for _, row := range stored {
+		if !used[row.ID] {
+			leftover = append(leftover, row)
+		}
+	}
+	for _, chunk := range unmatched {
+		if len(leftover) == 0 {
+			plan.Added = append(plan.Added, chunk)
+			continue
+		}
+		plan.Updated = append(plan.Updated, chunkMatch{Chunk: chunk, Row: leftover[0]})
+		leftover = leftover[1:]
+	}
+	for _, row := range leftover {
+		plan.Removed = append(plan.Removed, row.ID)
+	}
+	return plan
+}
@@ -0,0 +1,188 @@
+package knowledge
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"stockmind/internal/agent"
+	"stockmind/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// testChunks returns the chunks of a single page document made of texts, in order
+func testChunks(texts ...string) []pageChunk {
+	chunks := make([]pageChunk, 0, len(texts))
+	offset := 0
+	for i, text := range texts {
+		chunks = append(chunks, pageChunk{
+			Index:      i,
+			PageNumber: 1,
+			Chunk:      agent.Chunk{Text: text, Start: offset, End: offset + len(text), Index: i},
+			Hash:       contentHash(text),
+		})
+		offset += len(text)
+	}
+	return chunks
+}
+
+// storedRows returns the embedded rows of chunks. Row IDs are derived from the position and
+// text of the chunk, so rows of duplicate chunks can be told apart.
+func storedRows(chunks []pageChunk) []database.ListDocumentChunkHashesRow {
+	rows := make([]database.ListDocumentChunkHashesRow, 0, len(chunks))
+	for _, chunk := range chunks {
+		rows = append(rows, database.ListDocumentChunkHashesRow{
+			ID:          testRowID(chunk.Index, chunk.Chunk.Text),
+			ChunkIndex:  int32(chunk.Index),
+			PageNumber:  int32(chunk.PageNumber),
+			StartOffset: int32(chunk.Chunk.Start),
+			EndOffset:   int32(chunk.Chunk.End),
+			ContentHash: chunk.Hash,
+			Embedded:    true,
+		})
+	}
+	return rows
+}
+
+func testRowID(index int, text string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceOID, fmt.Appendf(nil, "%d:%s", index, text))
+}
+
+// planSummary describes a plan with the chunk texts and the stored rows they use
+type planSummary struct {
+	unchanged []string // "<text>@<row>", suffixed with " moved" when the chunk changed position
+	updated   []string // "<text>@<row>"
+	added     []string
+	removed   []uuid.UUID
+}
+
+func summarize(plan chunkPlan) planSummary {
+	var s planSummary
+	for _, match := range plan.Unchanged {
+		entry := fmt.Sprintf("%s@%s", match.Chunk.Chunk.Text, match.Row.ID)
+		if match.moved() {
+			entry += " moved"
+		}
+		s.unchanged = append(s.unchanged, entry)
+	}
+	for _, match := range plan.Updated {
+		s.updated = append(s.updated, fmt.Sprintf("%s@%s", match.Chunk.Chunk.Text, match.Row.ID))
+	}
+	for _, chunk := range plan.Added {
+		s.added = append(s.added, chunk.Chunk.Text)
+	}
+	s.removed = plan.Removed
+	return s
+}
+
+func TestPlanChunks(t *testing.T) {
+	at := func(text string, index int) string {
+		return fmt.Sprintf("%s@%s", text, testRowID(index, text))
+	}
+	tests := []struct {
+		name   string
+		stored []database.ListDocumentChunkHashesRow
+		chunks []pageChunk
+		want   planSummary
+	}{
+		{
+			name:   "unchanged document",
+			stored: storedRows(testChunks("a", "b")),
+			chunks: testChunks("a", "b"),
+			want:   planSummary{unchanged: []string{at("a", 0), at("b", 1)}},
+		},
+		{
+			name:   "chunks moved by an insertion keep their rows",
+			stored: storedRows(testChunks("a", "b")),
+			chunks: testChunks("new", "a", "b"),
+			want: planSummary{
+				unchanged: []string{at("a", 0) + " moved", at("b", 1) + " moved"},
+				added:     []string{"new"},
+			},
+		},
+		{
+			name:   "changed chunk reuses the row it replaces",
+			stored: storedRows(testChunks("a", "b")),
+			chunks: testChunks("a", "b2"),
+			want: planSummary{
+				unchanged: []string{at("a", 0)},
+				updated:   []string{"b2@" + testRowID(1, "b").String()},
+			},
+		},
+		{
+			name:   "deleted chunk is removed",
+			stored: storedRows(testChunks("a", "b", "c")),
+			chunks: testChunks("a", "c"),
+			want: planSummary{
+				unchanged: []string{at("a", 0), at("c", 2) + " moved"},
+				removed:   []uuid.UUID{testRowID(1, "b")},
+			},
+		},
+		{
+			name:   "leftover rows are reused in document order",
+			stored: storedRows(testChunks("a", "b", "c")),
+			chunks: testChunks("a", "x", "y", "z"),
+			want: planSummary{
+				unchanged: []string{at("a", 0)},
+				updated:   []string{"x@" + testRowID(1, "b").String(), "y@" + testRowID(2, "c").String()},
+				added:     []string{"z"},
+			},
+		},
+		{
+			name:   "duplicate chunk matches one row each",
+			stored: storedRows(testChunks("a", "a")),
+			chunks: testChunks("a"),
+			want: planSummary{
+				unchanged: []string{at("a", 0)},
+				removed:   []uuid.UUID{testRowID(1, "a")},
+			},
+		},
+		{
+			name:   "extra duplicate chunk is added",
+			stored: storedRows(testChunks("a")),
+			chunks: testChunks("a", "a"),
+			want: planSummary{
+				unchanged: []string{at("a", 0)},
+				added:     []string{"a"},
+			},
+		},
+		{
+			name: "rows stored without hash are never unchanged",
+			stored: func() []database.ListDocumentChunkHashesRow {
+				rows := storedRows(testChunks("a"))
+				rows[0].ContentHash = ""
+				return rows
+			}(),
+			chunks: testChunks("a"),
+			want:   planSummary{updated: []string{at("a", 0)}},
+		},
+		{
+			name:   "new document",
+			chunks: testChunks("a", "b"),
+			want:   planSummary{added: []string{"a", "b"}},
+		},
+		{
+			name:   "emptied document",
+			stored: storedRows(testChunks("a", "b")),
+			want:   planSummary{removed: []uuid.UUID{testRowID(0, "a"), testRowID(1, "b")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(planChunks(tt.stored, tt.chunks))
+			if !slices.Equal(got.unchanged, tt.want.unchanged) {
+				t.Errorf("unchanged = %q, want %q", got.unchanged, tt.want.unchanged)
+			}
+			if !slices.Equal(got.updated, tt.want.updated) {
+				t.Errorf("updated = %q, want %q", got.updated, tt.want.updated)
+			}
+			if !slices.Equal(got.added, tt.want.added) {
+				t.Errorf("added = %q, want %q", got.added, tt.want.added)
+			}
+			if !slices.Equal(got.removed, tt.want.removed) {
+				t.Errorf("removed = %v, want %v", got.removed, tt.want.removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package knowledge
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLLoader converts an HTML page to Markdown: headings become # headings, list items
+// become "- " lines and tables become Markdown tables. Scripts, styles and navigation are dropped.
+type HTMLLoader struct{}
+
+func (HTMLLoader) Load(path string) (Content, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	doc, err := html.Parse(f)
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to parse html %s: %w", path, err)
+	}
+	w := &htmlWriter{}
+	w.walk(doc)
+	content := Content{
+		Title:      w.title,
+		Structured: true,
+	}
+	if text := normalizeText(w.sb.String()); text != "" {
+		content.Pages = []Page{{Number: 1, Text: text}}
+	}
+	return content, nil
+}
+
+type htmlWriter struct {
+	sb    strings.Builder
+	title string
+	// inline collects the text of the current block until it is flushed
+	inline strings.Builder
+	// listDepth is the nesting level of the current list item
+	listDepth int
+}
+
+// flushBlock writes the pending inline text as a block with the given prefix
+func (w *htmlWriter) flushBlock(prefix string) {
+	text := strings.Join(strings.Fields(w.inline.String()), " ")
+	w.inline.Reset()
+	if text == "" {
+		return
+	}
+	w.sb.WriteString(prefix + text + "\n\n")
+}
+
+func (w *htmlWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.inline.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.walk(c)
+		}
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Nav, atom.Footer, atom.Template, atom.Svg:
+		return
+	case atom.Title:
+		w.title = strings.TrimSpace(htmlText(n))
+		return
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.flushBlock("")
+		level := int(n.Data[1] - '0')
+		w.inline.WriteString(htmlText(n))
+		w.flushBlock(strings.Repeat("#", level) + " ")
+		return
+	case atom.Table:
+		w.flushBlock("")
+		w.writeTable(n)
+		return
+	case atom.Li:
+		w.flushBlock("")
+		indent := strings.Repeat("  ", max(w.listDepth-1, 0))
+		// Text of the item first, nested lists are written after it
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Ul || c.DataAtom == atom.Ol {
+				continue
+			}
+			w.walkInline(c)
+		}
+		text := strings.Join(strings.Fields(w.inline.String()), " ")
+		w.inline.Reset()
+		if text != "" {
+			w.sb.WriteString(indent + "- " + text + "\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Ul || c.DataAtom == atom.Ol {
+				w.walk(c)
+			}
+		}
+		return
+	case atom.Ul, atom.Ol:
+		w.flushBlock("")
+		w.listDepth++
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			w.walk(c)
+		}
+		w.listDepth--
+		if w.listDepth == 0 {
+			w.sb.WriteString("\n")
+		}
+		return
+	case atom.Br:
+		w.inline.WriteString("\n")
+		return
+	}
+
+	block := isHTMLBlock(n)
+	if block {
+		w.flushBlock("")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+	if block {
+		w.flushBlock("")
+	}
+}
+
+// walkInline collects the text of n into the pending inline text
+func (w *htmlWriter) walkInline(n *html.Node) {
+	if n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style) {
+		return
+	}
+	if n.Type == html.TextNode {
+		w.inline.WriteString(n.Data)
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walkInline(c)
+	}
+	if n.Type == html.ElementNode && isHTMLBlock(n) {
+		w.inline.WriteString(" ")
+	}
+}
+
+// writeTable renders the rows of a table, including those of thead, tbody and tfoot, as a Markdown table
+func (w *htmlWriter) writeTable(table *html.Node) {
+	var rows [][]string
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, htmlText(cell))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case atom.Table:
+				// Nested tables are flattened into the cell text of their parent
+			default:
+				collect(c)
+			}
+		}
+	}
+	collect(table)
+	writeMarkdownTable(&w.sb, rows)
+	w.sb.WriteString("\n")
+}
+
+// htmlText returns the text content of n
+func htmlText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+			if c.Type == html.ElementNode && isHTMLBlock(c) {
+				sb.WriteString(" ")
+			}
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+func isHTMLBlock(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Aside,
+		atom.Blockquote, atom.Pre, atom.Figure, atom.Figcaption, atom.Dl, atom.Dt, atom.Dd,
+		atom.Tr, atom.Td, atom.Th, atom.Body, atom.Form, atom.Address, atom.Hr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package knowledge
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Content is the normalized text of a source document
+type Content struct {
+	// Title is the title found in the document metadata, empty when there is none
+	Title string
+	Pages []Page
+	// Structured reports that the text carries Markdown headings, lists and tables,
+	// which the structural chunking strategy follows
+	Structured bool
+}
+
+// Loader reads a source document into normalized text
+type Loader interface {
+	Load(path string) (Content, error)
+}
+
+// loadersByExtension maps the supported file extensions to their loader
+var loadersByExtension = map[string]Loader{
+	".pdf":      PDFLoader{},
+	".html":     HTMLLoader{},
+	".htm":      HTMLLoader{},
+	".docx":     DOCXLoader{},
+	".csv":      CSVLoader{},
+	".txt":      TextLoader{},
+	".md":       TextLoader{Markdown: true},
+	".markdown": TextLoader{Markdown: true},
+}
+
+// extensionsByMIMEType maps the supported MIME types to the extension of their loader
+var extensionsByMIMEType = map[string]string{
+	"application/pdf": ".pdf",
+	"text/html":       ".html",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+	"text/csv":      ".csv",
+	"text/plain":    ".txt",
+	"text/markdown": ".md",
+}
+
+// LoaderFor returns the loader of a document, selected by the extension of path or,
+// when the extension is unknown, by mimeType
+func LoaderFor(path, mimeType string) (Loader, error) {
+	if loader, ok := loadersByExtension[strings.ToLower(filepath.Ext(path))]; ok {
+		return loader, nil
+	}
+	if ext := extensionForMIMEType(mimeType); ext != "" {
+		return loadersByExtension[ext], nil
+	}
+	return nil, fmt.Errorf("unsupported document type: %s", filepath.Base(path))
+}
+
+// Supported reports whether a loader exists for the extension of path
+func Supported(path string) bool {
+	_, ok := loadersByExtension[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// UploadName returns the name an uploaded file is stored under. Files without a supported
+// extension get the extension of their MIME type, so they can be loaded again when re-indexed.
+func UploadName(filename, mimeType string) (string, error) {
+	if Supported(filename) {
+		return filename, nil
+	}
+	if ext := extensionForMIMEType(mimeType); ext != "" {
+		return filename + ext, nil
+	}
+	return "", fmt.Errorf("unsupported document type: %s", filename)
+}
+
+func extensionForMIMEType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	return extensionsByMIMEType[mediaType]
+}
+
+// TextLoader loads plain text and Markdown files
+type TextLoader struct {
+	Markdown bool
+}
+
+func (l TextLoader) Load(path string) (Content, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	text := normalizeText(string(data))
+	if text == "" {
+		return Content{Structured: l.Markdown}, nil
+	}
+	return Content{
+		Pages:      []Page{{Number: 1, Text: text}},
+		Structured: l.Markdown,
+	}, nil
+}
+
+// normalizeText makes text valid UTF-8 with \n line breaks and trims it. Chunk offsets
+// index the normalized text, so every loader normalizes before the text is stored or chunked.
+func normalizeText(text string) string {
+	text = strings.ToValidUTF8(text, "\uFFFD")
+	text = strings.TrimPrefix(text, "\uFEFF")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.TrimSpace(text)
+}
+
+// markdownCell escapes a table cell so it stays on one row of a Markdown table
+func markdownCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// writeMarkdownTable renders rows as a Markdown table whose first row is the header
+func writeMarkdownTable(sb *strings.Builder, rows [][]string) {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	if width == 0 {
+		return
+	}
+	for i, row := range rows {
+		sb.WriteString("|")
+		for j := range width {
+			cell := ""
+			if j < len(row) {
+				cell = markdownCell(row[j])
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+		sb.WriteString("\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat("---|", width) + "\n")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package knowledge
+
+import (
+	"fmt"
+
+	"github.com/ledongthuc/pdf"
+)
+
+type Page struct {
+	// Number is the 1-based page number in the source document
+	Number int
+	Text   string
+}
+
+// PDFLoader extracts the plain text of every page of a PDF file
+type PDFLoader struct{}
+
+func (PDFLoader) Load(path string) (Content, error) {
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		return Content{}, fmt.Errorf("failed to open pdf %s: %w", path, err)
+	}
+	defer f.Close()
+
+	pages := make([]Page, 0, r.NumPage())
+	for i := 1; i <= r.NumPage(); i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		text, err := p.GetPlainText(nil)
+		if err != nil {
+			return Content{}, fmt.Errorf("failed to extract text from page %d of %s: %w", i, path, err)
+		}
+		text = normalizeText(text)
+		if text == "" {
+			continue
+		}
+		pages = append(pages, Page{Number: i, Text: text})
+	}
+	return Content{Pages: pages}, nil
+}
@@ -0,0 +1,570 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"stockmind/internal/agent"
+	"stockmind/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultDir is where the knowledge base documents are shipped
+const DefaultDir = "schema/knowledge_base"
+
+// UploadDir is where documents uploaded through the API are stored, one directory per knowledge base
+var UploadDir = getEnv("KNOWLEDGE_BASE_UPLOAD_DIR", "data/knowledge_base")
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrInvalidName   = errors.New("invalid name")
+)
+
+// namePattern restricts knowledge base names to characters that are safe in a directory name
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateName checks that name can be used as a knowledge base name. Names are used as the
+// upload directory of the knowledge base, so only letters, digits, underscores and hyphens are allowed.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("knowledge base %q: %w, only letters, digits, underscores and hyphens are allowed", name, ErrInvalidName)
+	}
+	return nil
+}
+
+type IngestOptions struct {
+	KnowledgeBase string
+	Strategy      agent.ChunkingStrategy
+	ChunkSize     int
+	Overlap       int
+	// Force chunks documents again even when their content and chunking options are unchanged
+	Force bool
+}
+
+// Validate checks the chunking options before any document is read
+func (o IngestOptions) Validate() error {
+	if !o.Strategy.Valid() {
+		return fmt.Errorf("unsupported chunking strategy: %s", o.Strategy)
+	}
+	_, err := agent.NewChunking(o.ChunkSize, o.Overlap)
+	return err
+}
+
+// IngestStats counts what happened to the chunks of documents during ingestion
+type IngestStats struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+	// Skipped reports that the document was unchanged and not chunked again
+	Skipped bool `json:"skipped"`
+}
+
+// Chunks returns the number of chunks stored after ingestion
+func (s IngestStats) Chunks() int {
+	return s.Added + s.Updated + s.Unchanged
+}
+
+func (s *IngestStats) add(other IngestStats) {
+	s.Added += other.Added
+	s.Updated += other.Updated
+	s.Removed += other.Removed
+	s.Unchanged += other.Unchanged
+}
+
+type Service struct {
+	db       *pgxpool.Pool
+	queries  *database.Queries
+	embedder agent.Embedder
+	store    *agent.VectorStore // nil when chunks are stored without embeddings
+	llm      *agent.LLMClientWrapper
+	llmModel string
+}
+
+// NewService creates the ingestion service. When embedder is nil the chunks are not embedded
+func NewService(dbPool *pgxpool.Pool, embedder agent.Embedder) *Service {
+	queries := database.New(dbPool)
+	s := &Service{
+		db:       dbPool,
+		queries:  queries,
+		embedder: embedder,
+	}
+	if embedder != nil {
+		s.store = agent.NewVectorStore(queries, embedder)
+	}
+	return s
+}
+
+// SetChunkingLLM configures the model used by the agentic chunking strategy
+func (s *Service) SetChunkingLLM(llm *agent.LLMClientWrapper, model string) {
+	s.llm = llm
+	s.llmModel = model
+}
+
+// ListKnowledgeBases returns every knowledge base ordered by name
+func (s *Service) ListKnowledgeBases(ctx context.Context) ([]database.KnowledgeBase, error) {
+	kbs, err := s.queries.ListKnowledgeBases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list knowledge bases: %w", err)
+	}
+	return kbs, nil
+}
+
+// GetKnowledgeBase returns the knowledge base with the given name, or ErrNotFound
+func (s *Service) GetKnowledgeBase(ctx context.Context, name string) (database.KnowledgeBase, error) {
+	kb, err := s.queries.GetKnowledgeBaseByName(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return kb, fmt.Errorf("knowledge base %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return kb, fmt.Errorf("failed to get knowledge base %s: %w", name, err)
+	}
+	return kb, nil
+}
+
+// CreateKnowledgeBase creates an empty knowledge base, or fails with ErrAlreadyExists
+func (s *Service) CreateKnowledgeBase(ctx context.Context, name, description string) (database.KnowledgeBase, error) {
+	if err := ValidateName(name); err != nil {
+		return database.KnowledgeBase{}, err
+	}
+	if _, err := s.GetKnowledgeBase(ctx, name); err == nil {
+		return database.KnowledgeBase{}, fmt.Errorf("knowledge base %s: %w", name, ErrAlreadyExists)
+	} else if !errors.Is(err, ErrNotFound) {
+		return database.KnowledgeBase{}, err
+	}
+	kb, err := s.queries.CreateKnowledgeBase(ctx, database.CreateKnowledgeBaseParams{
+		ID:          uuid.Must(uuid.NewV7()),
+		Name:        name,
+		Description: pgtype.Text{String: description, Valid: description != ""},
+	})
+	if err != nil {
+		return kb, fmt.Errorf("failed to create knowledge base %s: %w", name, err)
+	}
+	return kb, nil
+}
+
+// GetOrCreateKnowledgeBase returns the knowledge base with the given name, creating it if needed
+func (s *Service) GetOrCreateKnowledgeBase(ctx context.Context, name string) (database.KnowledgeBase, error) {
+	if err := ValidateName(name); err != nil {
+		return database.KnowledgeBase{}, err
+	}
+	kb, err := s.queries.GetKnowledgeBaseByName(ctx, name)
+	if err == nil {
+		return kb, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return kb, fmt.Errorf("failed to get knowledge base %s: %w", name, err)
+	}
+	return s.queries.CreateKnowledgeBase(ctx, database.CreateKnowledgeBaseParams{
+		ID:          uuid.Must(uuid.NewV7()),
+		Name:        name,
+		Description: pgtype.Text{},
+	})
+}
+
+// IngestDir ingests every supported document found in dir into the knowledge base
+func (s *Service) IngestDir(ctx context.Context, dir string, opts IngestOptions) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read knowledge base directory %s: %w", dir, err)
+	}
+	kb, err := s.GetOrCreateKnowledgeBase(ctx, opts.KnowledgeBase)
+	if err != nil {
+		return err
+	}
+	var total IngestStats
+	for _, entry := range entries {
+		if entry.IsDir() || !Supported(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		doc, stats, err := s.IngestFile(ctx, kb, path, opts)
+		if err != nil {
+			return err
+		}
+		total.add(stats)
+		if stats.Skipped {
+			log.Printf("Skipped %s, unchanged since it was last ingested into knowledge base %s", doc.Source, kb.Name)
+			continue
+		}
+		log.Printf("Ingested %s into knowledge base %s: %d pages, %d chunks (%d added, %d updated, %d removed, %d unchanged)",
+			doc.Source, kb.Name, doc.PageCount, stats.Chunks(), stats.Added, stats.Updated, stats.Removed, stats.Unchanged)
+	}
+	log.Printf("Knowledge base %s: %d chunks added, %d updated, %d removed, %d unchanged", kb.Name, total.Added, total.Updated, total.Removed, total.Unchanged)
+	return nil
+}
+
+// IngestFile loads a document, chunks it page by page and brings the stored chunks of the
+// document up to date. Without a strategy, documents whose loader reports Markdown structure
+// are chunked with the structural strategy and the others recursively.
+//
+// Documents whose content and chunking options did not change since the last ingestion are
+// skipped unless opts.Force is set. Otherwise chunks are matched to the stored ones by content
+// hash, so only new or changed chunks are embedded and chunks that no longer exist are deleted.
+func (s *Service) IngestFile(ctx context.Context, kb database.KnowledgeBase, path string, opts IngestOptions) (database.Document, IngestStats, error) {
+	var doc database.Document
+	var stats IngestStats
+	loader, err := LoaderFor(path, "")
+	if err != nil {
+		return doc, stats, err
+	}
+	content, err := loader.Load(path)
+	if err != nil {
+		return doc, stats, err
+	}
+	if opts.Strategy == "" {
+		opts.Strategy = agent.ChunkingStrategyRecursive
+		if content.Structured {
+			opts.Strategy = agent.ChunkingStrategyStructural
+		}
+	}
+	title := content.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	hash := documentHash(title, content.Pages)
+	model := ""
+	if s.store != nil {
+		model = s.embedder.Model()
+	}
+
+	existing, err := s.queries.GetDocumentBySource(ctx, database.GetDocumentBySourceParams{
+		KnowledgeBaseID: kb.ID,
+		Source:          filepath.Base(path),
+	})
+	found := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return doc, stats, fmt.Errorf("failed to get document %s: %w", path, err)
+	}
+	var stored []database.ListDocumentChunkHashesRow
+	if found {
+		stored, err = s.queries.ListDocumentChunkHashes(ctx, database.ListDocumentChunkHashesParams{
+			Model:      model,
+			DocumentID: existing.ID,
+		})
+		if err != nil {
+			return doc, stats, fmt.Errorf("failed to list chunks of document %s: %w", path, err)
+		}
+	}
+	if found && !opts.Force && existing.ContentHash == hash && existing.Path == path && sameChunking(existing, opts) {
+		embedded := true
+		for _, row := range stored {
+			embedded = embedded && (s.store == nil || row.Embedded)
+		}
+		// A document stored without embeddings is chunked again so its chunks get embedded
+		if embedded {
+			return existing, IngestStats{Unchanged: len(stored), Skipped: true}, nil
+		}
+	}
+
+	chunking, err := agent.NewChunking(opts.ChunkSize, opts.Overlap)
+	if err != nil {
+		return doc, stats, err
+	}
+	if s.embedder != nil {
+		if err := chunking.SetEmbedder(s.embedder, agent.DefaultBreakpointPercentile); err != nil {
+			return doc, stats, err
+		}
+	}
+	if s.llm != nil {
+		if err := chunking.SetLLM(s.llm, s.llmModel); err != nil {
+			return doc, stats, err
+		}
+	}
+	if opts.Strategy == agent.ChunkingStrategyFixedSizeWithTokenization || opts.Strategy == agent.ChunkingStrategyRecursiveWithTokenization {
+		tokenizer, err := agent.DefaultTokenizer()
+		if err != nil {
+			return doc, stats, err
+		}
+		if err := chunking.SetTokenizer(tokenizer); err != nil {
+			return doc, stats, err
+		}
+	}
+	var chunks []pageChunk
+	for _, page := range content.Pages {
+		split, err := chunking.Split(ctx, opts.Strategy, page.Text)
+		if err != nil {
+			return doc, stats, err
+		}
+		for _, chunk := range split {
+			chunks = append(chunks, pageChunk{
+				Index:      len(chunks),
+				PageNumber: page.Number,
+				Chunk:      chunk,
+				Hash:       contentHash(chunk.Text),
+			})
+		}
+	}
+
+	// The embedding provider is called before the transaction is opened, so a slow provider does
+	// not hold a pooled connection and row locks. The plan is computed again in the transaction.
+	vectors, err := s.embedChunks(ctx, planChunks(stored, chunks))
+	if err != nil {
+		return doc, stats, fmt.Errorf("failed to embed chunks of document %s: %w", path, err)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return doc, stats, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	q := s.queries.WithTx(tx)
+
+	doc, err = q.UpsertDocument(ctx, database.UpsertDocumentParams{
+		ID:               uuid.Must(uuid.NewV7()),
+		KnowledgeBaseID:  kb.ID,
+		Source:           filepath.Base(path),
+		Title:            title,
+		PageCount:        int32(len(content.Pages)),
+		ChunkingStrategy: string(opts.Strategy),
+		ChunkSize:        int32(opts.ChunkSize),
+		ChunkOverlap:     int32(opts.Overlap),
+		Path:             path,
+		ContentHash:      hash,
+	})
+	if err != nil {
+		return doc, stats, fmt.Errorf("failed to upsert document %s: %w", path, err)
+	}
+	stored, err = q.ListDocumentChunkHashes(ctx, database.ListDocumentChunkHashesParams{
+		Model:      model,
+		DocumentID: doc.ID,
+	})
+	if err != nil {
+		return doc, stats, fmt.Errorf("failed to list chunks of document %s: %w", path, err)
+	}
+	plan := planChunks(stored, chunks)
+
+	if len(plan.Removed) > 0 {
+		if err := q.DeleteDocumentChunksByID(ctx, plan.Removed); err != nil {
+			return doc, stats, fmt.Errorf("failed to delete chunks of document %s: %w", path, err)
+		}
+	}
+	var embed []database.DocumentChunk
+	for _, match := range plan.Unchanged {
+		if match.moved() {
+			if _, err := q.UpdateDocumentChunk(ctx, updateChunkParams(match)); err != nil {
+				return doc, stats, fmt.Errorf("failed to update chunk %d of document %s: %w", match.Chunk.Index, path, err)
+			}
+		}
+		if !match.Row.Embedded {
+			embed = append(embed, database.DocumentChunk{ID: match.Row.ID, Content: match.Chunk.Chunk.Text, ContentHash: match.Chunk.Hash})
+		}
+	}
+	for _, match := range plan.Updated {
+		row, err := q.UpdateDocumentChunk(ctx, updateChunkParams(match))
+		if err != nil {
+			return doc, stats, fmt.Errorf("failed to update chunk %d of document %s: %w", match.Chunk.Index, path, err)
+		}
+		embed = append(embed, row)
+	}
+	for _, chunk := range plan.Added {
+		row, err := q.CreateDocumentChunk(ctx, database.CreateDocumentChunkParams{
+			ID:          uuid.Must(uuid.NewV7()),
+			DocumentID:  doc.ID,
+			ChunkIndex:  int32(chunk.Index),
+			PageNumber:  int32(chunk.PageNumber),
+			StartOffset: int32(chunk.Chunk.Start),
+			EndOffset:   int32(chunk.Chunk.End),
+			Content:     chunk.Chunk.Text,
+			ContentHash: chunk.Hash,
+		})
+		if err != nil {
+			return doc, stats, fmt.Errorf("failed to store chunk %d of document %s: %w", chunk.Index, path, err)
+		}
+		embed = append(embed, row)
+	}
+
+	if s.store != nil {
+		embeddings := make([][]float32, len(embed))
+		for i, chunk := range embed {
+			vector, ok := vectors[chunk.ContentHash]
+			if !ok {
+				return doc, stats, fmt.Errorf("document %s changed while it was ingested, try again", path)
+			}
+			embeddings[i] = vector
+		}
+		if err := s.store.WithTx(tx).Store(ctx, embed, embeddings); err != nil {
+			return doc, stats, fmt.Errorf("failed to store embeddings of document %s: %w", path, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return doc, stats, fmt.Errorf("failed to commit document %s: %w", path, err)
+	}
+	return doc, IngestStats{
+		Added:     len(plan.Added),
+		Updated:   len(plan.Updated),
+		Removed:   len(plan.Removed),
+		Unchanged: len(plan.Unchanged),
+	}, nil
+}
+
+// embedChunks embeds the chunks the plan stores without an embedding and returns the vectors by
+// content hash. Nothing is embedded when the service has no embedder.
+func (s *Service) embedChunks(ctx context.Context, plan chunkPlan) (map[string][]float32, error) {
+	if s.store == nil {
+		return nil, nil
+	}
+	var texts, hashes []string
+	seen := make(map[string]bool)
+	add := func(chunk pageChunk) {
+		if !seen[chunk.Hash] {
+			seen[chunk.Hash] = true
+			texts = append(texts, chunk.Chunk.Text)
+			hashes = append(hashes, chunk.Hash)
+		}
+	}
+	for _, match := range plan.Unchanged {
+		if !match.Row.Embedded {
+			add(match.Chunk)
+		}
+	}
+	for _, match := range plan.Updated {
+		add(match.Chunk)
+	}
+	for _, chunk := range plan.Added {
+		add(chunk)
+	}
+	vectors, err := s.store.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d chunks", len(vectors), len(texts))
+	}
+	byHash := make(map[string][]float32, len(hashes))
+	for i, hash := range hashes {
+		byHash[hash] = vectors[i]
+	}
+	return byHash, nil
+}
+
+// sameChunking reports whether doc was chunked with the options
+func sameChunking(doc database.Document, opts IngestOptions) bool {
+	return doc.ChunkingStrategy == string(opts.Strategy) &&
+		doc.ChunkSize == int32(opts.ChunkSize) &&
+		doc.ChunkOverlap == int32(opts.Overlap)
+}
+
+func updateChunkParams(match chunkMatch) database.UpdateDocumentChunkParams {
+	return database.UpdateDocumentChunkParams{
+		ID:          match.Row.ID,
+		ChunkIndex:  int32(match.Chunk.Index),
+		PageNumber:  int32(match.Chunk.PageNumber),
+		StartOffset: int32(match.Chunk.Chunk.Start),
+		EndOffset:   int32(match.Chunk.Chunk.End),
+		Content:     match.Chunk.Chunk.Text,
+		ContentHash: match.Chunk.Hash,
+	}
+}
+
+// ListDocuments returns the documents of a knowledge base with their number of chunks
+func (s *Service) ListDocuments(ctx context.Context, kb database.KnowledgeBase) ([]database.ListDocumentsRow, error) {
+	docs, err := s.queries.ListDocuments(ctx, kb.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents of knowledge base %s: %w", kb.Name, err)
+	}
+	return docs, nil
+}
+
+// GetDocument returns a document of the knowledge base, or ErrNotFound
+func (s *Service) GetDocument(ctx context.Context, kb database.KnowledgeBase, id uuid.UUID) (database.Document, error) {
+	doc, err := s.queries.GetDocumentByID(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && doc.KnowledgeBaseID != kb.ID) {
+		return database.Document{}, fmt.Errorf("document %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return doc, fmt.Errorf("failed to get document %s: %w", id, err)
+	}
+	return doc, nil
+}
+
+// SaveUpload stores an uploaded file in the upload directory of the knowledge base and
+// returns its path. Only the base name of filename is used, and the final path is checked to be
+// inside UploadDir, so uploads cannot escape the directory.
+func (s *Service) SaveUpload(kb database.KnowledgeBase, filename string, r io.Reader) (string, error) {
+	if err := ValidateName(kb.Name); err != nil {
+		return "", err
+	}
+	name := filepath.Base(filename)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid file name %q", filename)
+	}
+	dir := filepath.Join(UploadDir, kb.Name)
+	path := filepath.Join(dir, name)
+	if !insideDir(UploadDir, path) {
+		return "", fmt.Errorf("upload path %s is outside of %s", path, UploadDir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create upload directory %s: %w", dir, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// ReindexDocument chunks the source file of a document again with new options. Chunks whose
+// content did not change keep their embeddings.
+func (s *Service) ReindexDocument(ctx context.Context, kb database.KnowledgeBase, id uuid.UUID, opts IngestOptions) (database.Document, IngestStats, error) {
+	doc, err := s.GetDocument(ctx, kb, id)
+	if err != nil {
+		return doc, IngestStats{}, err
+	}
+	if doc.Path == "" {
+		return doc, IngestStats{}, fmt.Errorf("document %s was ingested before source paths were recorded, upload it again", doc.Source)
+	}
+	opts.Force = true
+	return s.IngestFile(ctx, kb, doc.Path, opts)
+}
+
+// DeleteDocument deletes a document with its chunks and embeddings. The source file is removed
+// too when it was uploaded through the API.
+func (s *Service) DeleteDocument(ctx context.Context, kb database.KnowledgeBase, id uuid.UUID) error {
+	doc, err := s.GetDocument(ctx, kb, id)
+	if err != nil {
+		return err
+	}
+	if err := s.queries.DeleteDocument(ctx, doc.ID); err != nil {
+		return fmt.Errorf("failed to delete document %s: %w", doc.Source, err)
+	}
+	if doc.Path != "" && filepath.Dir(doc.Path) == filepath.Join(UploadDir, kb.Name) {
+		if err := os.Remove(doc.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove uploaded file %s: %v", doc.Path, err)
+		}
+	}
+	return nil
+}
+
+// insideDir reports whether path is strictly inside dir once both are cleaned
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,85 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"stockmind/internal/agent"
+	"stockmind/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultSearchTopK = 5
+	maxSearchTopK     = 50
+)
+
+type KnowledgeSearchResult struct {
+	Text       string    `json:"text"`
+	Source     string    `json:"source"`
+	Title      string    `json:"title"`
+	Page       int32     `json:"page"`
+	Score      float64   `json:"score"`
+	DocumentID uuid.UUID `json:"document_id"`
+	ChunkID    uuid.UUID `json:"chunk_id"`
+}
+
+type KnowledgeSearchResponse struct {
+	Query         string                  `json:"query"`
+	KnowledgeBase string                  `json:"knowledge_base"`
+	Results       []KnowledgeSearchResult `json:"results"`
+}
+
+// searchKnowledgeBase searches a knowledge base with the same hybrid retrieval the built-in agent uses
+func searchKnowledgeBase(searcher *agent.KnowledgeSearcher) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		query, err := request.RequireString("query")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if strings.TrimSpace(query) == "" {
+			return mcp.NewToolResultError("query must not be empty"), nil
+		}
+		kbName := request.GetString("knowledge_base", database.DefaultKnowledgeBaseName)
+		topK := request.GetInt("top_k", defaultSearchTopK)
+		if topK <= 0 || topK > maxSearchTopK {
+			return mcp.NewToolResultError(fmt.Sprintf("top_k must be between 1 and %d", maxSearchTopK)), nil
+		}
+
+		chunks, err := searcher.Search(ctx, database.RetrievalConfig{
+			KnowledgeBase: kbName,
+			Mode:          database.RetrievalModeHybrid,
+			TopK:          int64(topK),
+		}, query)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to search knowledge base %s: %v", kbName, err)), nil
+		}
+
+		response := KnowledgeSearchResponse{
+			Query:         query,
+			KnowledgeBase: kbName,
+			Results:       make([]KnowledgeSearchResult, 0, len(chunks)),
+		}
+		var text strings.Builder
+		for i, chunk := range chunks {
+			response.Results = append(response.Results, KnowledgeSearchResult{
+				Text:       chunk.Content,
+				Source:     chunk.Source,
+				Title:      chunk.Title,
+				Page:       chunk.PageNumber,
+				Score:      chunk.Score,
+				DocumentID: chunk.DocumentID,
+				ChunkID:    chunk.ChunkID,
+			})
+			fmt.Fprintf(&text, "[%d] %s, page %d\n%s\n\n", i+1, chunk.Source, chunk.PageNumber, strings.TrimSpace(chunk.Content))
+		}
+		if len(chunks) == 0 {
+			text.WriteString("No relevant documents found")
+		}
+		return mcp.NewToolResultStructured(response, strings.TrimSpace(text.String())), nil
+	}
+}
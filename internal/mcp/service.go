@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 
+	"stockmind/internal/agent"
+
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func Start(ctx context.Context, protocol string) error {
+// Start runs the MCP server. The search_knowledge_base tool is only registered when a
+// knowledge searcher is given, i.e. when the database is reachable.
+func Start(ctx context.Context, protocol string, knowledge *agent.KnowledgeSearcher) error {
 	fmt.Println("Starting MCP service...")
 	s := server.NewMCPServer(
 		"StockMind MCP Server 🚀",
@@ -61,6 +65,25 @@ func Start(ctx context.Context, protocol string) error {
 		getStockPrice,
 	)
 
+	if knowledge != nil {
+		s.AddTool(
+			mcp.NewTool("search_knowledge_base",
+				mcp.WithDescription("Search the documents of a knowledge base (financial reports, research) and return the most relevant excerpts with their source, page and score"),
+				mcp.WithString("query",
+					mcp.Required(),
+					mcp.Description("What to search for, e.g., HPG revenue 2024"),
+				),
+				mcp.WithString("knowledge_base",
+					mcp.Description("Knowledge base name. Default is default"),
+				),
+				mcp.WithNumber("top_k",
+					mcp.Description("Number of excerpts to return. Default is 5"),
+				),
+			),
+			searchKnowledgeBase(knowledge),
+		)
+	}
+
 	// Start the server
 	switch protocol {
 	case "stdio":
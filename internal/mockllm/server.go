@@ -0,0 +1,241 @@
+// Package mockllm is a fake OpenAI compatible provider for tests. It replays scripted chat
+// completions, streamed like the chat completions API does, so agents and sessions can be
+// exercised without calling OpenRouter.
+package mockllm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Response is a scripted answer to one chat completion request
+type Response struct {
+	// Text is streamed as content deltas, word by word
+	Text string
+	// Reasoning is streamed as reasoning deltas before the text
+	Reasoning string
+	// ToolCalls are streamed after the text, their arguments split over several deltas
+	ToolCalls []ToolCall
+	// FinishReason defaults to tool_calls when there are tool calls and stop otherwise
+	FinishReason openai.FinishReason
+	// Status answers with an HTTP error instead of a completion when not 0
+	Status int
+	// Error is the message of the HTTP error
+	Error string
+}
+
+// ToolCall is a scripted tool call of a response
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// Server is an httptest server answering chat completion requests with the scripted responses
+// in order. A request arriving after the script is exhausted fails with a 500 error.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []openai.ChatCompletionRequest
+}
+
+// NewServer starts a server replaying responses, its URL is the base URL of the OpenAI client.
+// Close it when done.
+func NewServer(responses ...Response) *Server {
+	s := &Server{responses: responses}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", s.chatCompletions)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Enqueue appends responses to the script
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []openai.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionRequest{}, s.requests...)
+}
+
+// Pending returns the number of scripted responses not replayed yet
+func (s *Server) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.responses)
+}
+
+func (s *Server) next(request openai.ChatCompletionRequest) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, request)
+	if len(s.responses) == 0 {
+		return Response{}, false
+	}
+	response := s.responses[0]
+	s.responses = s.responses[1:]
+	return response, true
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var request openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	response, ok := s.next(request)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("no scripted response left for request %d", len(s.Requests())))
+		return
+	}
+	if response.Status != 0 {
+		writeError(w, response.Status, response.Error)
+		return
+	}
+	if response.FinishReason == "" {
+		response.FinishReason = openai.FinishReasonStop
+		if len(response.ToolCalls) > 0 {
+			response.FinishReason = openai.FinishReasonToolCalls
+		}
+	}
+	if request.Stream {
+		stream(w, request.Model, response)
+		return
+	}
+	complete(w, request.Model, response)
+}
+
+// chunk is a streamed chat completion chunk. The delta carries the reasoning field OpenRouter
+// adds to the OpenAI format.
+type chunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []chunkChoice `json:"choices"`
+}
+
+type chunkChoice struct {
+	Index        int                 `json:"index"`
+	Delta        chunkDelta          `json:"delta"`
+	FinishReason openai.FinishReason `json:"finish_reason,omitempty"`
+}
+
+type chunkDelta struct {
+	Role      string            `json:"role,omitempty"`
+	Content   string            `json:"content,omitempty"`
+	Reasoning string            `json:"reasoning,omitempty"`
+	ToolCalls []openai.ToolCall `json:"tool_calls,omitempty"`
+}
+
+// stream writes the response as server-sent chunks: the role, the reasoning and text word by
+// word, each tool call with its name then its arguments in two halves, the finish reason
+// and [DONE]
+func stream(w http.ResponseWriter, model string, response Response) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	send := func(delta chunkDelta, finishReason openai.FinishReason) {
+		data, _ := json.Marshal(chunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   model,
+			Choices: []chunkChoice{{Delta: delta, FinishReason: finishReason}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	send(chunkDelta{Role: openai.ChatMessageRoleAssistant}, "")
+	for _, word := range splitWords(response.Reasoning) {
+		send(chunkDelta{Reasoning: word}, "")
+	}
+	for _, word := range splitWords(response.Text) {
+		send(chunkDelta{Content: word}, "")
+	}
+	for i, call := range response.ToolCalls {
+		index := i
+		send(chunkDelta{ToolCalls: []openai.ToolCall{{
+			Index:    &index,
+			ID:       call.ID,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: call.Name},
+		}}}, "")
+		half := len(call.Arguments) / 2
+		for _, part := range []string{call.Arguments[:half], call.Arguments[half:]} {
+			if part != "" {
+				send(chunkDelta{ToolCalls: []openai.ToolCall{{Index: &index, Function: openai.FunctionCall{Arguments: part}}}}, "")
+			}
+		}
+	}
+	send(chunkDelta{}, response.FinishReason)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// complete writes the response as a single chat completion
+func complete(w http.ResponseWriter, model string, response Response) {
+	message := openai.ChatCompletionMessage{
+		Role:             openai.ChatMessageRoleAssistant,
+		Content:          response.Text,
+		ReasoningContent: response.Reasoning,
+	}
+	for _, call := range response.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:       call.ID,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{{Message: message, FinishReason: response.FinishReason}},
+	})
+}
+
+// writeError writes an error in the format of the OpenAI API
+func writeError(w http.ResponseWriter, status int, message string) {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": "mock_error", "code": status},
+	})
+}
+
+// splitWords splits text into words keeping the spaces, so the deltas join back into text
+func splitWords(text string) []string {
+	var words []string
+	for text != "" {
+		i := strings.IndexByte(text[1:], ' ')
+		if i < 0 {
+			words = append(words, text)
+			break
+		}
+		words = append(words, text[:i+1])
+		text = text[i+1:]
+	}
+	return words
+}
@@ -0,0 +1,217 @@
+//go:build integration
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"stockmind/internal/agent"
+	"stockmind/internal/database"
+	"stockmind/internal/mockllm"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// chatUserID is the user chatHandler creates sessions for
+const chatUserID = "123e4567-e89b-12d3-a456-426614174000"
+
+// repoRoot is the directory the stdio MCP server of the default flow ("go run cmd/main.go mcp")
+// is started in
+const repoRoot = "../.."
+
+// connectTestDB connects to the database configured by the DB_* variables and migrates it, the
+// test is skipped when the database is unreachable
+func connectTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dbUrl := "postgres://" + os.Getenv("DB_USERNAME") + ":" + url.QueryEscape(os.Getenv("DB_PASSWORD")) + "@" + os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT") + "/" + os.Getenv("DB_DATABASE") + "?sslmode=disable"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dbPool, err := pgxpool.New(ctx, dbUrl)
+	if err != nil {
+		t.Skipf("database is not configured: %v", err)
+	}
+	if err := dbPool.Ping(ctx); err != nil {
+		dbPool.Close()
+		t.Skipf("database is unreachable: %v", err)
+	}
+	t.Cleanup(dbPool.Close)
+	if err := database.MigrateDBFS(dbPool, os.DirFS(filepath.Join(repoRoot, "schema"))); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	_, err = dbPool.Exec(context.Background(),
+		"INSERT INTO users (id, name, email, provider) VALUES ($1, 'Integration Test', 'integration-test@stockmind.local', 'test') ON CONFLICT (id) DO NOTHING",
+		chatUserID)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	return dbPool
+}
+
+// sseEvent is an event written by chatHandler
+type sseEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Text     string `json:"text"`
+		Thinking string `json:"thinking"`
+	} `json:"data"`
+}
+
+func readSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event sseEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// messageText joins the text of a message, whether sent as a string or as parts
+func messageText(message openai.ChatCompletionMessage) string {
+	text := message.Content
+	for _, part := range message.MultiContent {
+		text += part.Text
+	}
+	return text
+}
+
+// TestChatHandlerToolCallTurn drives a chat turn where the model calls an MCP tool of the
+// stdio server before answering
+func TestChatHandlerToolCallTurn(t *testing.T) {
+	dbPool := connectTestDB(t)
+	queries := database.New(dbPool)
+	userID := uuid.MustParse(chatUserID)
+
+	llm := mockllm.NewServer(
+		mockllm.Response{
+			Reasoning: "I should add the numbers with the tool.",
+			ToolCalls: []mockllm.ToolCall{{ID: "call_1", Name: "stocks-mcp--add_numbers", Arguments: `{"a":2,"b":3}`}},
+		},
+		mockllm.Response{Text: "2 plus 3 is 5."},
+	)
+	defer llm.Close()
+
+	// Keep retrieval and the MCP server, which inherits the environment, off the network
+	t.Setenv("EMBEDDING_PROVIDER", "hash")
+	embedding := agent.EmbeddingProvider
+	embedding.Provider = "hash"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agentService, err := agent.NewServiceWithConfig(ctx, dbPool, agent.ServiceConfig{
+		Providers: agent.LLMProviderConfig{
+			OpenAI:    agent.OpenAIConfig{AuthType: "open_router", APIKey: "test", BaseURL: llm.URL},
+			Anthropic: agent.AnthropicProvider,
+		},
+		Embedding: embedding,
+		WorkDir:   repoRoot,
+	})
+	if err != nil {
+		t.Fatalf("failed to create agent service: %v", err)
+	}
+	s := &Server{db: queries, agent: agentService}
+
+	before, err := queries.GetSessionsByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("failed to list sessions: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat", strings.NewReader(`{"content":"What is 2 plus 3?"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(rec, req)
+
+	// Streamed events
+	var text, thinking string
+	for _, event := range readSSE(t, rec.Body.String()) {
+		switch event.Type {
+		case "text_delta":
+			text += event.Data.Text
+		case "thinking_delta":
+			thinking += event.Data.Thinking
+		}
+	}
+	if text != "2 plus 3 is 5." {
+		t.Errorf("streamed text = %q, want %q", text, "2 plus 3 is 5.")
+	}
+	if thinking != "I should add the numbers with the tool." {
+		t.Errorf("streamed thinking = %q", thinking)
+	}
+
+	// Requests sent to the model
+	if llm.Pending() != 0 {
+		t.Fatalf("%d scripted responses were not requested", llm.Pending())
+	}
+	requests := llm.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d model requests, want 2", len(requests))
+	}
+	hasTool := false
+	for _, tool := range requests[0].Tools {
+		if tool.Function != nil && tool.Function.Name == "stocks-mcp--add_numbers" {
+			hasTool = true
+		}
+	}
+	if !hasTool {
+		t.Errorf("first request does not offer the stocks-mcp--add_numbers tool")
+	}
+	messages := requests[1].Messages
+	toolMessage := messages[len(messages)-1]
+	if toolMessage.Role != openai.ChatMessageRoleTool || toolMessage.ToolCallID != "call_1" {
+		t.Fatalf("last message of the second request is %s for %q, want the tool result of call_1", toolMessage.Role, toolMessage.ToolCallID)
+	}
+	if result := messageText(toolMessage); !strings.Contains(result, `"result":5`) {
+		t.Errorf("tool result = %q, want the sum computed by the MCP server", result)
+	}
+
+	// Session history
+	after, err := queries.GetSessionsByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("failed to list sessions: %v", err)
+	}
+	if len(after) != len(before)+1 {
+		t.Fatalf("got %d new sessions, want 1", len(after)-len(before))
+	}
+	session := after[len(after)-1]
+	defer queries.DeleteSessionByID(context.Background(), session.ID)
+	history, err := queries.GetSessionHistoryBySessionID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("failed to get session history: %v", err)
+	}
+	wantStopReasons := []database.StopReason{
+		database.StopReasonUserInput,
+		database.StopReasonToolCall,
+		database.StopReasonToolResult,
+		database.StopReasonAgentDone,
+	}
+	if len(history) != len(wantStopReasons) {
+		t.Fatalf("got %d history rows, want %d", len(history), len(wantStopReasons))
+	}
+	for i, row := range history {
+		if row.StopReason != wantStopReasons[i] {
+			t.Errorf("history row %d stop reason = %s, want %s", i, row.StopReason, wantStopReasons[i])
+		}
+	}
+	if model := history[len(history)-1].Model; model != agent.NEMOTRON_NANO_9B_V2 {
+		t.Errorf("answer recorded for model %q, want %q", model, agent.NEMOTRON_NANO_9B_V2)
+	}
+}
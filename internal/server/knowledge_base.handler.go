@@ -0,0 +1,234 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"stockmind/internal/agent"
+	"stockmind/internal/database"
+	"stockmind/internal/knowledge"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxUploadSize is the largest document accepted by UploadDocumentHandler
+const maxUploadSize = 64 << 20
+
+type CreateKnowledgeBaseRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type IngestRequest struct {
+	Strategy  agent.ChunkingStrategy `json:"strategy"`
+	ChunkSize int                    `json:"chunk_size"`
+	Overlap   int                    `json:"overlap"`
+}
+
+type IngestResponse struct {
+	Document   database.Document     `json:"document"`
+	ChunkCount int                   `json:"chunk_count"`
+	Chunks     knowledge.IngestStats `json:"chunks"`
+}
+
+func (req IngestRequest) options(kb database.KnowledgeBase) knowledge.IngestOptions {
+	opts := knowledge.IngestOptions{
+		KnowledgeBase: kb.Name,
+		Strategy:      req.Strategy,
+		ChunkSize:     req.ChunkSize,
+		Overlap:       req.Overlap,
+	}
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = 1000
+	}
+	return opts
+}
+
+func (s *Server) CreateKnowledgeBaseHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateKnowledgeBaseRequest
+
+	// Parse JSON request body
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	req.Name = strings.TrimSpace(req.Name)
+	if err := knowledge.ValidateName(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	kb, err := s.knowledge.CreateKnowledgeBase(r.Context(), req.Name, req.Description)
+	if err != nil {
+		writeKnowledgeError(w, "Failed to create knowledge base", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, kb)
+}
+
+func (s *Server) GetKnowledgeBasesHandler(w http.ResponseWriter, r *http.Request) {
+	kbs, err := s.knowledge.ListKnowledgeBases(r.Context())
+	if err != nil {
+		writeKnowledgeError(w, "Failed to get knowledge bases", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, kbs)
+}
+
+func (s *Server) GetDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	kb, err := s.knowledge.GetKnowledgeBase(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeKnowledgeError(w, "Knowledge base not found", err)
+		return
+	}
+	docs, err := s.knowledge.ListDocuments(r.Context(), kb)
+	if err != nil {
+		writeKnowledgeError(w, "Failed to get documents", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, docs)
+}
+
+// UploadDocumentHandler ingests the multipart "file" field. The chunking options are read
+// from the optional "strategy", "chunk_size" and "overlap" form fields.
+func (s *Server) UploadDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	kb, err := s.knowledge.GetKnowledgeBase(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeKnowledgeError(w, "Knowledge base not found", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		http.Error(w, "Invalid multipart form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "A file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	filename, err := knowledge.UploadName(header.Filename, header.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := IngestRequest{Strategy: agent.ChunkingStrategy(r.FormValue("strategy"))}
+	if req.ChunkSize, err = formInt(r, "chunk_size"); err != nil {
+		http.Error(w, "Invalid chunk_size", http.StatusBadRequest)
+		return
+	}
+	if req.Overlap, err = formInt(r, "overlap"); err != nil {
+		http.Error(w, "Invalid overlap", http.StatusBadRequest)
+		return
+	}
+	opts := req.options(kb)
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path, err := s.knowledge.SaveUpload(kb, filename, file)
+	if err != nil {
+		http.Error(w, "Failed to save document: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	doc, stats, err := s.knowledge.IngestFile(r.Context(), kb, path, opts)
+	if err != nil {
+		http.Error(w, "Failed to ingest document: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, IngestResponse{Document: doc, ChunkCount: stats.Chunks(), Chunks: stats})
+}
+
+func (s *Server) ReindexDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	kb, err := s.knowledge.GetKnowledgeBase(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeKnowledgeError(w, "Knowledge base not found", err)
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	var req IngestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	opts := req.options(kb)
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc, stats, err := s.knowledge.ReindexDocument(r.Context(), kb, id, opts)
+	if err != nil {
+		writeKnowledgeError(w, "Failed to re-index document", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, IngestResponse{Document: doc, ChunkCount: stats.Chunks(), Chunks: stats})
+}
+
+func (s *Server) DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	kb, err := s.knowledge.GetKnowledgeBase(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeKnowledgeError(w, "Knowledge base not found", err)
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.knowledge.DeleteDocument(r.Context(), kb, id); err != nil {
+		writeKnowledgeError(w, "Failed to delete document", err)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeKnowledgeError maps the errors of the knowledge service to HTTP status codes
+func writeKnowledgeError(w http.ResponseWriter, msg string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, knowledge.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, knowledge.ErrAlreadyExists):
+		status = http.StatusConflict
+	case errors.Is(err, knowledge.ErrInvalidName):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, msg+": "+err.Error(), status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func formInt(r *http.Request, key string) (int, error) {
+	value := r.FormValue(key)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
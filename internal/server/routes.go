@@ -49,6 +49,16 @@ func (s *Server) RegisterRoutes() http.Handler {
 			r.Delete("/{id}", s.DeleteUserHandler)
 		})
 
+		// Knowledge bases
+		r.Route("/knowledge-bases", func(r chi.Router) {
+			r.Post("/", s.CreateKnowledgeBaseHandler)
+			r.Get("/", s.GetKnowledgeBasesHandler)
+			r.Get("/{name}/documents", s.GetDocumentsHandler)
+			r.Post("/{name}/documents", s.UploadDocumentHandler)
+			r.Post("/{name}/documents/{id}/reindex", s.ReindexDocumentHandler)
+			r.Delete("/{name}/documents/{id}", s.DeleteDocumentHandler)
+		})
+
 		// Threads
 		// r.Route("/threads", func(r chi.Router) {
 		// 	r.Post("/", s.CreateThreadHandler)
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"stockmind/internal/agent"
 	"stockmind/internal/database"
+	"stockmind/internal/knowledge"
 	"strconv"
 	"time"
 
@@ -13,20 +14,22 @@ import (
 )
 
 type Server struct {
-	port  int
-	db    *database.Queries
-	agent *agent.AgentService
+	port      int
+	db        *database.Queries
+	agent     *agent.AgentService
+	knowledge *knowledge.Service
 }
 
-func NewServer(dbPool *pgxpool.Pool, agent *agent.AgentService, port string) *http.Server {
+func NewServer(dbPool *pgxpool.Pool, agent *agent.AgentService, knowledge *knowledge.Service, port string) *http.Server {
 	portInt, err := strconv.Atoi(port)
 	if err != nil {
 		portInt = 8080
 	}
 	NewServer := &Server{
-		port:  portInt,
-		db:    database.New(dbPool),
-		agent: agent,
+		port:      portInt,
+		db:        database.New(dbPool),
+		agent:     agent,
+		knowledge: knowledge,
 	}
 
 	// Declare Server config
@@ -0,0 +1,53 @@
+-- Knowledge base tables used by the document ingestion pipeline
+-- +goose Up
+-- =============================================
+-- TABLE CREATION
+-- =============================================
+
+-- Knowledge bases group documents that can be retrieved together
+CREATE TABLE IF NOT EXISTS knowledge_bases (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Documents ingested into a knowledge base, one row per source file
+CREATE TABLE IF NOT EXISTS documents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    knowledge_base_id UUID NOT NULL REFERENCES knowledge_bases(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    title TEXT NOT NULL,
+    page_count INT4 NOT NULL DEFAULT 0,
+    chunking_strategy TEXT NOT NULL,
+    chunk_size INT4 NOT NULL,
+    chunk_overlap INT4 NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (knowledge_base_id, source)
+);
+
+-- Chunks of a document. Offsets are byte offsets into the text of the page
+CREATE TABLE IF NOT EXISTS document_chunks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    chunk_index INT4 NOT NULL,
+    page_number INT4 NOT NULL,
+    start_offset INT4 NOT NULL,
+    end_offset INT4 NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_chunks_document_id ON document_chunks(document_id);
+
+-- Default knowledge base for the documents shipped in schema/knowledge_base
+INSERT INTO knowledge_bases (id, name, description) VALUES
+('0199a0c4-3b1e-7c2a-9f4e-1d2b3c4d5e6f', 'default', 'Documents shipped in schema/knowledge_base')
+ON CONFLICT (name) DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS document_chunks;
+DROP TABLE IF EXISTS documents;
+DROP TABLE IF EXISTS knowledge_bases;
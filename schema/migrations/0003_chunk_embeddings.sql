@@ -0,0 +1,18 @@
+-- Vector store for document chunks, backed by pgvector
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS vector;
+
+-- Embedding of each document chunk. The vector has no fixed dimension so that
+-- embedders with different sizes can be used, rows are matched on model instead
+CREATE TABLE IF NOT EXISTS chunk_embeddings (
+    chunk_id UUID PRIMARY KEY REFERENCES document_chunks(id) ON DELETE CASCADE,
+    model TEXT NOT NULL,
+    embedding vector NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chunk_embeddings_model ON chunk_embeddings(model);
+
+-- +goose Down
+DROP TABLE IF EXISTS chunk_embeddings;
@@ -0,0 +1,10 @@
+-- Ground the Default Flow agent in the default knowledge base
+-- +goose Up
+UPDATE agent_flows
+SET config = jsonb_set(config, '{agents,NormalChat,retrieval}', '{"knowledgeBase": "default", "topK": 5, "minScore": 0.3}'::jsonb)
+WHERE id = '01993ca8-a62e-79e3-995c-a46e25a4a2a2';
+
+-- +goose Down
+UPDATE agent_flows
+SET config = config #- '{agents,NormalChat,retrieval}'
+WHERE id = '01993ca8-a62e-79e3-995c-a46e25a4a2a2';
@@ -0,0 +1,6 @@
+-- Full-text index over chunk contents for lexical (keyword) search
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_document_chunks_content_tsv ON document_chunks USING GIN (to_tsvector('simple', content));
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_document_chunks_content_tsv;
@@ -0,0 +1,6 @@
+-- Remember where the source file of a document lives so it can be re-indexed
+-- +goose Up
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS path TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE documents DROP COLUMN IF EXISTS path;
@@ -0,0 +1,8 @@
+-- Content hashes let ingestion skip unchanged documents and re-embed only the chunks that changed
+-- +goose Up
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE document_chunks ADD COLUMN IF NOT EXISTS content_hash TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE document_chunks DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE documents DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,6 @@
+-- The model that answered, which differs from the agent model when a fallback model was used
+-- +goose Up
+ALTER TABLE session_history ADD COLUMN IF NOT EXISTS model TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE session_history DROP COLUMN IF EXISTS model;
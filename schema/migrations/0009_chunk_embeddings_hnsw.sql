@@ -0,0 +1,11 @@
+-- Approximate nearest neighbour index over chunk embeddings. The embedding column has no fixed
+-- dimension so that embedders of different sizes share the table, and pgvector cannot index it
+-- as is, so the index is built on a cast to the dimension of the configured embedders and only
+-- covers the rows of that dimension. Embeddings of other sizes are still searched by a scan.
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_chunk_embeddings_hnsw_1536 ON chunk_embeddings
+    USING hnsw ((embedding::vector(1536)) vector_cosine_ops)
+    WHERE vector_dims(embedding) = 1536;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_chunk_embeddings_hnsw_1536;
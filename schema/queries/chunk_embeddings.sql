@@ -0,0 +1,26 @@
+-- name: UpsertChunkEmbedding :exec
+INSERT INTO chunk_embeddings (chunk_id, model, embedding) VALUES ($1, $2, $3)
+ON CONFLICT (chunk_id) DO UPDATE SET
+    model = EXCLUDED.model,
+    embedding = EXCLUDED.embedding,
+    updated_at = NOW();
+
+-- name: SearchChunkEmbeddings :many
+SELECT c.id, c.document_id, d.source, d.title, c.page_number, c.start_offset, c.end_offset, c.content,
+    (1 - (e.embedding <=> sqlc.arg(embedding)::vector))::float8 AS score
+FROM chunk_embeddings e
+JOIN document_chunks c ON c.id = e.chunk_id
+JOIN documents d ON d.id = c.document_id
+WHERE d.knowledge_base_id = sqlc.arg(knowledge_base_id) AND e.model = sqlc.arg(model)
+ORDER BY e.embedding <=> sqlc.arg(embedding)::vector
+LIMIT sqlc.arg(top_k);
+
+-- name: SearchIndexedChunkEmbeddings :many
+SELECT c.id, c.document_id, d.source, d.title, c.page_number, c.start_offset, c.end_offset, c.content,
+    (1 - (e.embedding::vector(1536) <=> sqlc.arg(embedding)::vector(1536)))::float8 AS score
+FROM chunk_embeddings e
+JOIN document_chunks c ON c.id = e.chunk_id
+JOIN documents d ON d.id = c.document_id
+WHERE vector_dims(e.embedding) = 1536 AND d.knowledge_base_id = sqlc.arg(knowledge_base_id) AND e.model = sqlc.arg(model)
+ORDER BY e.embedding::vector(1536) <=> sqlc.arg(embedding)::vector(1536)
+LIMIT sqlc.arg(top_k);
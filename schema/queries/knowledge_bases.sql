@@ -0,0 +1,78 @@
+-- name: GetKnowledgeBaseByName :one
+SELECT * FROM knowledge_bases WHERE name = $1;
+
+-- name: ListKnowledgeBases :many
+SELECT * FROM knowledge_bases ORDER BY name;
+
+-- name: CreateKnowledgeBase :one
+INSERT INTO knowledge_bases (id, name, description) VALUES ($1, $2, $3) RETURNING *;
+
+-- name: UpsertDocument :one
+INSERT INTO documents (id, knowledge_base_id, source, title, page_count, chunking_strategy, chunk_size, chunk_overlap, path, content_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (knowledge_base_id, source) DO UPDATE SET
+    title = EXCLUDED.title,
+    page_count = EXCLUDED.page_count,
+    chunking_strategy = EXCLUDED.chunking_strategy,
+    chunk_size = EXCLUDED.chunk_size,
+    chunk_overlap = EXCLUDED.chunk_overlap,
+    path = EXCLUDED.path,
+    content_hash = EXCLUDED.content_hash,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetDocumentByID :one
+SELECT * FROM documents WHERE id = $1;
+
+-- name: GetDocumentBySource :one
+SELECT * FROM documents WHERE knowledge_base_id = $1 AND source = $2;
+
+-- name: ListDocuments :many
+SELECT d.id, d.knowledge_base_id, d.source, d.title, d.page_count, d.chunking_strategy, d.chunk_size, d.chunk_overlap,
+    d.path, d.created_at, d.updated_at, COUNT(c.id)::int4 AS chunk_count
+FROM documents d
+LEFT JOIN document_chunks c ON c.document_id = d.id
+WHERE d.knowledge_base_id = $1
+GROUP BY d.id
+ORDER BY d.source;
+
+-- name: DeleteDocument :exec
+DELETE FROM documents WHERE id = $1;
+
+-- name: DeleteDocumentChunks :exec
+DELETE FROM document_chunks WHERE document_id = $1;
+
+-- name: DeleteDocumentChunksByID :exec
+DELETE FROM document_chunks WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: ListDocumentChunkHashes :many
+SELECT c.id, c.chunk_index, c.page_number, c.start_offset, c.end_offset, c.content_hash,
+    EXISTS (SELECT 1 FROM chunk_embeddings e WHERE e.chunk_id = c.id AND e.model = sqlc.arg(model))::bool AS embedded
+FROM document_chunks c
+WHERE c.document_id = sqlc.arg(document_id)
+ORDER BY c.chunk_index;
+
+-- name: CreateDocumentChunk :one
+INSERT INTO document_chunks (id, document_id, chunk_index, page_number, start_offset, end_offset, content, content_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *;
+
+-- name: UpdateDocumentChunk :one
+UPDATE document_chunks SET
+    chunk_index = $2,
+    page_number = $3,
+    start_offset = $4,
+    end_offset = $5,
+    content = $6,
+    content_hash = $7
+WHERE id = $1
+RETURNING *;
+
+-- name: SearchDocumentChunks :many
+SELECT c.id, c.document_id, d.source, d.title, c.page_number, c.start_offset, c.end_offset, c.content,
+    ts_rank_cd(to_tsvector('simple', c.content), to_tsquery('simple', sqlc.arg(query)::text), 32)::float8 AS score
+FROM document_chunks c
+JOIN documents d ON d.id = c.document_id
+WHERE d.knowledge_base_id = sqlc.arg(knowledge_base_id)
+    AND to_tsvector('simple', c.content) @@ to_tsquery('simple', sqlc.arg(query)::text)
+ORDER BY score DESC
+LIMIT sqlc.arg(top_k);
@@ -8,10 +8,10 @@ SELECT * FROM sessions WHERE id = $1;
 UPDATE sessions SET turn_count = $2 WHERE id = $1;
 
 -- name: SessionAddChatHistory :one
-INSERT INTO session_history (id, session_id, content, stop_reason, node) VALUES ($1, $2, $3, $4, $5) RETURNING *;
+INSERT INTO session_history (id, session_id, content, stop_reason, node, model) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *;
 
 -- name: GetSessionHistoryBySessionID :many
-SELECT * FROM session_history WHERE session_id = $1 ORDER BY created_at ASC;
+SELECT * FROM session_history WHERE session_id = $1 ORDER BY created_at ASC, id ASC;
 
 -- name: GetSessionsByUserID :many
 SELECT * FROM sessions WHERE created_by = $1 ORDER BY created_at ASC;